@@ -4,19 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/ajankovic/smpp/pdu"
 )
 
 // Context represents container for SMPP request related information.
 type Context struct {
-	sess   *Session
-	status pdu.Status
-	ctx    context.Context
-	seq    uint32
-	req    pdu.PDU
-	resp   pdu.PDU
-	close  bool
+	sess      *Session
+	status    pdu.Status
+	reqStatus pdu.Status
+	ctx       context.Context
+	seq       uint32
+	req       pdu.PDU
+	resp      pdu.PDU
+	close     bool
+	hijacked  bool
+	finish    func()
+	// Guarded by session mutex.
+	responded bool
 }
 
 // SystemID returns SystemID of the bounded peer that request came from.
@@ -44,36 +50,117 @@ func (ctx *Context) Context() context.Context {
 	return ctx.ctx
 }
 
+// Set stores value under the key in the request context. Useful for
+// passing values from middleware to the downstream handlers.
+func (ctx *Context) Set(key, val interface{}) {
+	ctx.ctx = context.WithValue(ctx.ctx, key, val)
+}
+
+// Get returns value stored under the key in the request context.
+func (ctx *Context) Get(key interface{}) interface{} {
+	return ctx.ctx.Value(key)
+}
+
 // Status returns status of the current request.
 func (ctx *Context) Status() pdu.Status {
 	return ctx.status
 }
 
-// Respond sends pdu to the bounded peer.
+// RequestStatus returns command_status from the header of the incoming
+// request. Requests should always carry status 0 but some peers misuse it.
+func (ctx *Context) RequestStatus() pdu.Status {
+	return ctx.reqStatus
+}
+
+// Respond sends response pdu to the bounded peer. It's the terminal action of
+// the handler and should be called at most once per request, subsequent calls
+// return an error without sending anything. Use Send for sending additional
+// requests to the peer while handling the request.
 func (ctx *Context) Respond(resp pdu.PDU, status pdu.Status) error {
-	ctx.status = status
-	ctx.resp = resp
 	if resp == nil {
 		return errors.New("smpp: responding with nil PDU")
 	}
 
+	ctx.sess.advertiseVersion(resp)
 	ctx.sess.mu.Lock()
+	if ctx.responded {
+		ctx.sess.mu.Unlock()
+		return errors.New("smpp: request already responded")
+	}
 	if err := ctx.sess.makeTransition(resp.CommandID(), false); err != nil {
 		ctx.sess.conf.Logger.ErrorF("transitioning resp pdu: %s %+v", ctx.sess, err)
 		ctx.sess.mu.Unlock()
 		return err
 	}
-	if _, err := ctx.sess.enc.Encode(resp, pdu.EncodeStatus(status), pdu.EncodeSeq(ctx.seq)); err != nil {
+	if _, err := ctx.sess.encode(resp, pdu.EncodeStatus(status), pdu.EncodeSeq(ctx.seq)); err != nil {
 		ctx.sess.conf.Logger.ErrorF("error encoding pdu: %s %+v", ctx.sess, err)
 		ctx.sess.mu.Unlock()
 		return err
 	}
-	ctx.sess.conf.Logger.InfoF("sent response: %s %s %+v", ctx.sess, resp.CommandID(), resp)
+	// Response is recorded only once it's sent so failed attempts don't
+	// prevent responding again or automatic response.
+	ctx.status = status
+	ctx.resp = resp
+	ctx.responded = true
+	ctx.sess.conf.Logger.InfoF("sent response: %s %s", ctx.sess, pduDump{resp})
 	ctx.sess.mu.Unlock()
 
 	return nil
 }
 
+// Send sends request pdu to the bounded peer and waits for the response
+// within the request context. It can be called any number of times before
+// or after Respond.
+func (ctx *Context) Send(req pdu.PDU) (pdu.PDU, error) {
+	return ctx.sess.Send(ctx.ctx, req)
+}
+
+// AcceptBind responds to bind request with matching bind response with
+// provided systemID and status OK.
+func (ctx *Context) AcceptBind(systemID string) error {
+	resp := bindResponse(ctx.req, systemID)
+	if resp == nil {
+		return fmt.Errorf("smpp: accepting bind for PDU of type %s", ctx.req.CommandID())
+	}
+	return ctx.Respond(resp, pdu.StatusOK)
+}
+
+// AcceptUnbind responds to unbind request with unbind_resp with status OK
+// and initiates session shutdown after handler returns.
+func (ctx *Context) AcceptUnbind() error {
+	if ctx.req.CommandID() != pdu.UnbindID {
+		return fmt.Errorf("smpp: accepting unbind for PDU of type %s", ctx.req.CommandID())
+	}
+	if err := ctx.Respond(&pdu.UnbindResp{}, pdu.StatusOK); err != nil {
+		return err
+	}
+	ctx.CloseSession()
+	return nil
+}
+
+// Hijack takes over completion of the request from the handler so it can be
+// responded to after ServeSMPP returns. Request keeps its slot in the request
+// window until respond or release is called. Its context is still canceled
+// after WindowTimeout, same as for requests handled in ServeSMPP, since peer
+// stops waiting for the response by then, so responding should not be
+// delayed beyond it.
+// Respond sends the response and releases the request while release frees it
+// without responding. One of them MUST be called eventually, otherwise the
+// request window slot leaks and Session.Close blocks forever waiting for the
+// request to finish. Calling release more than once has no effect.
+func (ctx *Context) Hijack() (respond func(pdu.PDU, pdu.Status) error, release func()) {
+	ctx.hijacked = true
+	var once sync.Once
+	release = func() {
+		once.Do(ctx.finish)
+	}
+	respond = func(resp pdu.PDU, status pdu.Status) error {
+		defer release()
+		return ctx.Respond(resp, status)
+	}
+	return respond, release
+}
+
 // CloseSession will initiate session shutdown after handler returns.
 func (ctx *Context) CloseSession() {
 	ctx.close = true
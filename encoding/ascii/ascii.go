@@ -0,0 +1,28 @@
+// Package ascii implements IA5/ASCII encoding used for data_coding 0x01.
+package ascii
+
+import "fmt"
+
+// Encode converts string into ASCII bytes. It returns an error if
+// the string contains non-ASCII characters.
+func Encode(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0x7F {
+			return nil, fmt.Errorf("smpp/ascii: character %q can't be encoded", r)
+		}
+		out = append(out, byte(r))
+	}
+	return out, nil
+}
+
+// Decode converts ASCII bytes into string. It returns an error if
+// any of the bytes is outside of ASCII range.
+func Decode(b []byte) (string, error) {
+	for _, c := range b {
+		if c > 0x7F {
+			return "", fmt.Errorf("smpp/ascii: invalid byte 0x%02X", c)
+		}
+	}
+	return string(b), nil
+}
@@ -0,0 +1,34 @@
+package ascii_test
+
+import (
+	"testing"
+
+	"github.com/ajankovic/smpp/encoding/ascii"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	in := "Hello, World!"
+	out, err := ascii.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("Encode(%q) => %q", in, out)
+	}
+	dec, err := ascii.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != in {
+		t.Errorf("Decode() => %q expected %q", dec, in)
+	}
+}
+
+func TestEncodeNonASCII(t *testing.T) {
+	if _, err := ascii.Encode("café"); err == nil {
+		t.Error("expected error for non-ASCII character")
+	}
+	if _, err := ascii.Decode([]byte{'c', 0xE9}); err == nil {
+		t.Error("expected error for non-ASCII byte")
+	}
+}
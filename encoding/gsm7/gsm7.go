@@ -0,0 +1,97 @@
+// Package gsm7 implements GSM 03.38 default alphabet used as SMSC default
+// alphabet for data_coding 0x00. Characters are encoded as unpacked septets,
+// one character per byte, with extension table characters prefixed by
+// the escape character.
+package gsm7
+
+import "fmt"
+
+const escape = 0x1B
+
+var basic = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+var extension = map[byte]rune{
+	0x0A: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2F: '\\',
+	0x3C: '[',
+	0x3D: '~',
+	0x3E: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+var (
+	encBasic     = make(map[rune]byte, len(basic))
+	encExtension = make(map[rune]byte, len(extension))
+)
+
+func init() {
+	for i, r := range basic {
+		if i == escape {
+			continue
+		}
+		encBasic[r] = byte(i)
+	}
+	for b, r := range extension {
+		encExtension[r] = b
+	}
+}
+
+// Encode converts string into unpacked GSM 7-bit bytes. It returns an error
+// if the string contains characters not present in the default alphabet or
+// its extension table.
+func Encode(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if b, ok := encBasic[r]; ok {
+			out = append(out, b)
+			continue
+		}
+		if b, ok := encExtension[r]; ok {
+			out = append(out, escape, b)
+			continue
+		}
+		return nil, fmt.Errorf("smpp/gsm7: character %q can't be encoded", r)
+	}
+	return out, nil
+}
+
+// Decode converts unpacked GSM 7-bit bytes into string.
+func Decode(b []byte) (string, error) {
+	out := make([]rune, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c > 0x7F {
+			return "", fmt.Errorf("smpp/gsm7: invalid septet 0x%02X", c)
+		}
+		if c == escape && i+1 < len(b) {
+			i++
+			r, ok := extension[b[i]]
+			if !ok {
+				return "", fmt.Errorf("smpp/gsm7: invalid extension 0x%02X", b[i])
+			}
+			out = append(out, r)
+			continue
+		}
+		out = append(out, basic[c])
+	}
+	return string(out), nil
+}
+
+// Valid reports if string can be encoded using GSM 7-bit alphabet.
+func Valid(s string) bool {
+	for _, r := range s {
+		if _, ok := encBasic[r]; ok {
+			continue
+		}
+		if _, ok := encExtension[r]; ok {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package gsm7_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ajankovic/smpp/encoding/gsm7"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	in := "@£ Ünd {5€}"
+	expected := []byte{0x00, 0x01, 0x20, 0x5E, 0x6E, 0x64, 0x20, 0x1B, 0x28, 0x35, 0x1B, 0x65, 0x1B, 0x29}
+	out, err := gsm7.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("Encode(%q) => % X expected % X", in, out, expected)
+	}
+	dec, err := gsm7.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != in {
+		t.Errorf("Decode() => %q expected %q", dec, in)
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	if gsm7.Valid("Привет") {
+		t.Error("expected cyrillic to be invalid")
+	}
+	if _, err := gsm7.Encode("Привет"); err == nil {
+		t.Error("expected error for character outside of alphabet")
+	}
+}
@@ -0,0 +1,26 @@
+// Package latin1 implements ISO-8859-1 encoding used for data_coding 0x03.
+package latin1
+
+import "fmt"
+
+// Encode converts UTF-8 string into Latin-1 bytes. It returns an error if
+// the string contains characters that can't be represented in Latin-1.
+func Encode(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			return nil, fmt.Errorf("smpp/latin1: character %q can't be encoded", r)
+		}
+		out = append(out, byte(r))
+	}
+	return out, nil
+}
+
+// Decode converts Latin-1 bytes into UTF-8 string.
+func Decode(b []byte) string {
+	out := make([]rune, len(b))
+	for i, c := range b {
+		out[i] = rune(c)
+	}
+	return string(out)
+}
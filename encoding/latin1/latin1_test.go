@@ -0,0 +1,29 @@
+package latin1_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ajankovic/smpp/encoding/latin1"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	in := "Ça été déjà reçu"
+	expected := []byte{0xC7, 'a', ' ', 0xE9, 't', 0xE9, ' ', 'd', 0xE9, 'j', 0xE0, ' ', 'r', 'e', 0xE7, 'u'}
+	out, err := latin1.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("Encode(%q) => % X expected % X", in, out, expected)
+	}
+	if dec := latin1.Decode(out); dec != in {
+		t.Errorf("Decode() => %q expected %q", dec, in)
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	if _, err := latin1.Encode("price €5"); err == nil {
+		t.Error("expected error for character outside Latin-1")
+	}
+}
@@ -0,0 +1,31 @@
+// Package ucs2 implements UCS2 encoding used for data_coding 0x08.
+// Characters outside of the Basic Multilingual Plane are encoded as
+// UTF-16 surrogate pairs which is what most handsets expect.
+package ucs2
+
+import (
+	"errors"
+	"unicode/utf16"
+)
+
+// Encode converts string into big endian UCS2 bytes.
+func Encode(s string) []byte {
+	codes := utf16.Encode([]rune(s))
+	out := make([]byte, 0, len(codes)*2)
+	for _, c := range codes {
+		out = append(out, byte(c>>8), byte(c))
+	}
+	return out
+}
+
+// Decode converts big endian UCS2 bytes into string.
+func Decode(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", errors.New("smpp/ucs2: odd number of bytes")
+	}
+	codes := make([]uint16, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		codes = append(codes, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(codes)), nil
+}
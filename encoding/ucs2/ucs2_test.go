@@ -0,0 +1,27 @@
+package ucs2_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ajankovic/smpp/encoding/ucs2"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	in := "Привет"
+	expected := []byte{0x04, 0x1F, 0x04, 0x40, 0x04, 0x38, 0x04, 0x32, 0x04, 0x35, 0x04, 0x42}
+	out := ucs2.Encode(in)
+	if !bytes.Equal(out, expected) {
+		t.Errorf("Encode(%q) => % X expected % X", in, out, expected)
+	}
+	dec, err := ucs2.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != in {
+		t.Errorf("Decode() => %q expected %q", dec, in)
+	}
+	if _, err := ucs2.Decode([]byte{0x00}); err == nil {
+		t.Error("expected error for odd byte length")
+	}
+}
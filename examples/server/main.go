@@ -24,13 +24,8 @@ func main() {
 	sessConf := smpp.SessionConf{
 		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
 			switch ctx.CommandID() {
-			case pdu.BindTransceiverID:
-				btrx, err := ctx.BindTRx()
-				if err != nil {
-					fail("Invalid PDU in context error: %+v", err)
-				}
-				resp := btrx.Response(systemID)
-				if err := ctx.Respond(resp, pdu.StatusOK); err != nil {
+			case pdu.BindTransceiverID, pdu.BindTransmitterID, pdu.BindReceiverID:
+				if err := ctx.AcceptBind(systemID); err != nil {
 					fail("Server can't respond to the Binding request: %+v", err)
 				}
 			case pdu.SubmitSmID:
@@ -45,15 +40,9 @@ func main() {
 					fail("Server can't respond to the submit_sm request: %+v", err)
 				}
 			case pdu.UnbindID:
-				unb, err := ctx.Unbind()
-				if err != nil {
-					fail("Invalid PDU in context error: %+v", err)
-				}
-				resp := unb.Response()
-				if err := ctx.Respond(resp, pdu.StatusOK); err != nil {
-					fail("Server can't respond to the submit_sm request: %+v", err)
+				if err := ctx.AcceptUnbind(); err != nil {
+					fail("Server can't respond to the unbind request: %+v", err)
 				}
-				ctx.CloseSession()
 			}
 		}),
 	}
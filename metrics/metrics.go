@@ -0,0 +1,132 @@
+// Package metrics collects SMPP session events into counters and gauges.
+//
+// Counters implements smpp.Metrics so it can be set in SessionConf.Metrics.
+// Snapshot returns current values which can be exported to monitoring
+// systems, e.g. from the Collect method of the Prometheus collector.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/ajankovic/smpp"
+	"github.com/ajankovic/smpp/pdu"
+)
+
+// Snapshot holds values of all metrics at the moment it was taken.
+type Snapshot struct {
+	// ActiveSessions is the number of sessions that are not closed.
+	ActiveSessions int64
+	// Binds counts successful binds by bound state.
+	Binds map[smpp.SessionState]uint64
+	// PDUsSent counts PDUs written to connections by command id.
+	PDUsSent map[pdu.CommandID]uint64
+	// PDUsReceived counts PDUs read from connections by command id.
+	PDUsReceived map[pdu.CommandID]uint64
+	// Errors counts failures of reading, decoding and encoding PDUs.
+	Errors uint64
+	// Throttled counts requests rejected because request window was full.
+	Throttled uint64
+	// SendWindow is the number of sent requests waiting for response.
+	SendWindow int64
+	// ReceiveWindow is the number of received requests being handled.
+	ReceiveWindow int64
+}
+
+// Counters collects session events. It's safe for concurrent use and can be
+// shared between sessions.
+type Counters struct {
+	mu sync.Mutex
+	s  Snapshot
+}
+
+var _ smpp.Metrics = (*Counters)(nil)
+
+// New creates empty counters.
+func New() *Counters {
+	return &Counters{
+		s: Snapshot{
+			Binds:        make(map[smpp.SessionState]uint64),
+			PDUsSent:     make(map[pdu.CommandID]uint64),
+			PDUsReceived: make(map[pdu.CommandID]uint64),
+		},
+	}
+}
+
+// Snapshot returns copy of current values.
+func (c *Counters) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.s
+	s.Binds = make(map[smpp.SessionState]uint64, len(c.s.Binds))
+	for k, v := range c.s.Binds {
+		s.Binds[k] = v
+	}
+	s.PDUsSent = copyCounts(c.s.PDUsSent)
+	s.PDUsReceived = copyCounts(c.s.PDUsReceived)
+	return s
+}
+
+func copyCounts(m map[pdu.CommandID]uint64) map[pdu.CommandID]uint64 {
+	out := make(map[pdu.CommandID]uint64, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// SessionOpened implements smpp.Metrics interface.
+func (c *Counters) SessionOpened() {
+	c.mu.Lock()
+	c.s.ActiveSessions++
+	c.mu.Unlock()
+}
+
+// SessionBound implements smpp.Metrics interface.
+func (c *Counters) SessionBound(state smpp.SessionState) {
+	c.mu.Lock()
+	c.s.Binds[state]++
+	c.mu.Unlock()
+}
+
+// SessionClosed implements smpp.Metrics interface.
+func (c *Counters) SessionClosed() {
+	c.mu.Lock()
+	c.s.ActiveSessions--
+	c.mu.Unlock()
+}
+
+// PDUSent implements smpp.Metrics interface.
+func (c *Counters) PDUSent(id pdu.CommandID) {
+	c.mu.Lock()
+	c.s.PDUsSent[id]++
+	c.mu.Unlock()
+}
+
+// PDUReceived implements smpp.Metrics interface.
+func (c *Counters) PDUReceived(id pdu.CommandID) {
+	c.mu.Lock()
+	c.s.PDUsReceived[id]++
+	c.mu.Unlock()
+}
+
+// Error implements smpp.Metrics interface.
+func (c *Counters) Error(err error) {
+	c.mu.Lock()
+	c.s.Errors++
+	c.mu.Unlock()
+}
+
+// Throttled implements smpp.Metrics interface.
+func (c *Counters) Throttled() {
+	c.mu.Lock()
+	c.s.Throttled++
+	c.mu.Unlock()
+}
+
+// WindowChanged implements smpp.Metrics interface.
+func (c *Counters) WindowChanged(sent, received int) {
+	c.mu.Lock()
+	c.s.SendWindow += int64(sent)
+	c.s.ReceiveWindow += int64(received)
+	c.mu.Unlock()
+}
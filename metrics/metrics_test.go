@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ajankovic/smpp"
+	"github.com/ajankovic/smpp/internal/mock"
+	"github.com/ajankovic/smpp/metrics"
+	"github.com/ajankovic/smpp/pdu"
+)
+
+func marshal(t *testing.T, p pdu.PDU, seq uint32) []byte {
+	t.Helper()
+	b, err := pdu.Marshal(p, seq, pdu.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCountersBindSubmitUnbind(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	conn := mock.NewConn().
+		ByteWrite(marshal(t, bindTRx, 1)).ByteRead(marshal(t, bindTRx.Response("SMSC"), 1)).
+		ByteWrite(marshal(t, submitSm, 2)).ByteRead(marshal(t, submitSm.Response("id0"), 2)).
+		ByteWrite(marshal(t, pdu.Unbind{}, 3)).ByteRead(marshal(t, pdu.UnbindResp{}, 3)).
+		Closed()
+	counters := metrics.New()
+	sess := smpp.NewSession(conn, smpp.SessionConf{Metrics: counters})
+	if s := counters.Snapshot(); s.ActiveSessions != 1 {
+		t.Errorf("ActiveSessions => %d expected 1", s.ActiveSessions)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	for _, req := range []pdu.PDU{bindTRx, submitSm, pdu.Unbind{}} {
+		if _, err := sess.Send(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	s := counters.Snapshot()
+	if s.ActiveSessions != 0 {
+		t.Errorf("ActiveSessions => %d expected 0", s.ActiveSessions)
+	}
+	if n := s.Binds[smpp.StateBoundTRx]; n != 1 || len(s.Binds) != 1 {
+		t.Errorf("Binds => %v expected one transceiver bind", s.Binds)
+	}
+	for _, id := range []pdu.CommandID{pdu.BindTransceiverID, pdu.SubmitSmID, pdu.UnbindID} {
+		if s.PDUsSent[id] != 1 {
+			t.Errorf("PDUsSent[%s] => %d expected 1", id, s.PDUsSent[id])
+		}
+	}
+	for _, id := range []pdu.CommandID{pdu.BindTransceiverRespID, pdu.SubmitSmRespID, pdu.UnbindRespID} {
+		if s.PDUsReceived[id] != 1 {
+			t.Errorf("PDUsReceived[%s] => %d expected 1", id, s.PDUsReceived[id])
+		}
+	}
+	if s.Errors != 0 || s.Throttled != 0 {
+		t.Errorf("unexpected errors %d or throttles %d", s.Errors, s.Throttled)
+	}
+	if s.SendWindow != 0 || s.ReceiveWindow != 0 {
+		t.Errorf("windows => %d %d expected empty", s.SendWindow, s.ReceiveWindow)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
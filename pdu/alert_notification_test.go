@@ -0,0 +1,32 @@
+package pdu
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAlertNotification(t *testing.T) {
+	p := &AlertNotification{
+		SourceAddrTon: 1,
+		SourceAddrNpi: 1,
+		SourceAddr:    "38160111222",
+		EsmeAddr:      "1234",
+		Options:       NewOptions().SetMsAvailabilityStatus(MsAvailable),
+	}
+	buf := bytes.NewBuffer(nil)
+	if _, err := NewEncoder(buf, nil).Encode(p); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	_, got, err := NewDecoder(buf).Decode()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Decode() => %#v expected %#v", got, p)
+	}
+	status, ok := got.(*AlertNotification).Options.MsAvailabilityStatus()
+	if !ok || status != MsAvailable {
+		t.Errorf("MsAvailabilityStatus() => %d %t expected %d", status, ok, MsAvailable)
+	}
+}
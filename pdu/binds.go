@@ -2,6 +2,7 @@ package pdu
 
 import (
 	"fmt"
+	"regexp"
 )
 
 // BindTx binding pdu in transmitter mode.
@@ -232,6 +233,44 @@ func marshalBind(systemID, password, systemType string, interfaceVer, addrTon, a
 	return out, nil
 }
 
+// Outbind is sent by SMSC to ESME to request it to initiate bind_receiver.
+// It has no response.
+type Outbind struct {
+	SystemID string
+	Password string
+}
+
+// CommandID implements pdu.PDU interface.
+func (p Outbind) CommandID() CommandID {
+	return OutbindID
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler interface.
+func (p Outbind) MarshalBinary() ([]byte, error) {
+	out := append([]byte(p.SystemID), 0)
+	out = append(out, append([]byte(p.Password), 0)...)
+	return out, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler interface.
+func (p *Outbind) UnmarshalBinary(body []byte) error {
+	if len(body) < 2 {
+		return fmt.Errorf("smpp/pdu: outbind body too short: %d", len(body))
+	}
+	buf := newBuffer(body)
+	res, err := buf.ReadCString(16)
+	if err != nil {
+		return fmt.Errorf("smpp/pdu: decoding system_id %s", err)
+	}
+	p.SystemID = string(res)
+	res, err = buf.ReadCString(9)
+	if err != nil {
+		return fmt.Errorf("smpp/pdu: decoding password %s", err)
+	}
+	p.Password = string(res)
+	return nil
+}
+
 func unmarshalBind(body []byte, systemID, password, systemType *string, interfaceVer, addrTon, addrNpi *int, addrRange *string) error {
 	if len(body) < 7 {
 		return fmt.Errorf("smpp/pdu: bind body too short: %d", len(body))
@@ -274,3 +313,19 @@ func unmarshalBind(body []byte, systemID, password, systemType *string, interfac
 	*addrRange = string(res)
 	return nil
 }
+
+// MatchAddressRange reports whether addr belongs to the address_range pattern
+// sent in bind_receiver or bind_transceiver. Pattern is a regular expression
+// so anchors must be used explicitly, e.g. "^381" matches all addresses with
+// 381 prefix and "^38160123$" matches single address. Empty pattern matches
+// every address and invalid pattern doesn't match any.
+func MatchAddressRange(pattern, addr string) bool {
+	if pattern == "" {
+		return true
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(addr)
+}
@@ -0,0 +1,23 @@
+package pdu
+
+import "testing"
+
+func TestMatchAddressRange(t *testing.T) {
+	tt := []struct {
+		pattern string
+		addr    string
+		match   bool
+	}{
+		{"^381", "38160123456", true},
+		{"^381", "44712345678", false},
+		{"^38160123$", "38160123", true},
+		{"^38160123$", "381601234", false},
+		{"", "38160123", true},
+		{"[", "38160123", false},
+	}
+	for _, tc := range tt {
+		if got := MatchAddressRange(tc.pattern, tc.addr); got != tc.match {
+			t.Errorf("MatchAddressRange(%q, %q) => %v expected %v", tc.pattern, tc.addr, got, tc.match)
+		}
+	}
+}
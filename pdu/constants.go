@@ -186,3 +186,120 @@ const (
 	TagItsReplyType           TagID = 0x1380
 	TagItsSessionInfo         TagID = 0x1383
 )
+
+// USSD service operations used as ussd_service_op values.
+const (
+	UssdOpPSSDIndication = 0x00
+	UssdOpPSSRIndication = 0x01
+	UssdOpUSSRRequest    = 0x02
+	UssdOpUSSNRequest    = 0x03
+	UssdOpPSSDResponse   = 0x10
+	UssdOpPSSRResponse   = 0x11
+	UssdOpUSSRConfirm    = 0x12
+	UssdOpUSSNConfirm    = 0x13
+)
+
+// Privacy levels used as privacy_indicator values.
+const (
+	PrivacyNotRestricted = 0x00
+	PrivacyRestricted    = 0x01
+	PrivacyConfidential  = 0x02
+	PrivacySecret        = 0x03
+)
+
+// Payload types used as payload_type values.
+const (
+	PayloadTypeDefault = 0x00
+	PayloadTypeWCMP    = 0x01
+)
+
+// Display modes used as display_time values.
+const (
+	DisplayTimeTemporary = 0x00
+	DisplayTimeDefault   = 0x01
+	DisplayTimeInvoke    = 0x02
+)
+
+// Subaddress types used as the first octet of source_subaddress and
+// dest_subaddress values.
+const (
+	SubaddressNSAPEven = 0x80
+	SubaddressNSAPOdd  = 0x88
+	SubaddressUser     = 0xA0
+)
+
+// Network types used as source_network_type and dest_network_type values.
+const (
+	NetworkUnknown = 0x00
+	NetworkGSM     = 0x01
+	NetworkANSI136 = 0x02
+	NetworkIS95    = 0x03
+	NetworkPDC     = 0x04
+	NetworkPHS     = 0x05
+	NetworkIDEN    = 0x06
+	NetworkAMPS    = 0x07
+	NetworkPaging  = 0x08
+)
+
+// Bearer types used as source_bearer_type and dest_bearer_type values.
+const (
+	BearerUnknown       = 0x00
+	BearerSMS           = 0x01
+	BearerCSD           = 0x02
+	BearerPacketData    = 0x03
+	BearerUSSD          = 0x04
+	BearerCDPD          = 0x05
+	BearerDataTAC       = 0x06
+	BearerFLEX          = 0x07
+	BearerCellBroadcast = 0x08
+)
+
+// Languages used as language_indicator values.
+const (
+	LanguageUnspecified = 0x00
+	LanguageEnglish     = 0x01
+	LanguageFrench      = 0x02
+	LanguageSpanish     = 0x03
+	LanguageGerman      = 0x04
+	LanguagePortuguese  = 0x05
+)
+
+// ITS reply types used as its_reply_type values.
+const (
+	ItsReplyDigit         = 0x00
+	ItsReplyNumber        = 0x01
+	ItsReplyTelephoneNo   = 0x02
+	ItsReplyPassword      = 0x03
+	ItsReplyCharacterLine = 0x04
+	ItsReplyMenu          = 0x05
+	ItsReplyDate          = 0x06
+	ItsReplyTime          = 0x07
+	ItsReplyContinue      = 0x08
+)
+
+// Mobile station availability used as ms_availability_status values.
+const (
+	MsAvailable   = 0x00
+	MsDenied      = 0x01
+	MsUnavailable = 0x02
+)
+
+// Data coding schemes used as data_coding values.
+const (
+	DataCodingDefault = 0x00
+	DataCodingIA5     = 0x01
+	DataCodingBinary  = 0x02
+	DataCodingLatin1  = 0x03
+	DataCodingOctet   = 0x04
+	DataCodingUCS2    = 0x08
+)
+
+// Priority levels used as priority_flag values. Their meaning depends on
+// the network, for GSM only levels 0 (non-priority) and 1-3 (priority) are
+// distinguished.
+const (
+	PriorityLevel0 = 0x00
+	PriorityLevel1 = 0x01
+	PriorityLevel2 = 0x02
+	PriorityLevel3 = 0x03
+)
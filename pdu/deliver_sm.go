@@ -3,6 +3,7 @@ package pdu
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"time"
 
 	smpptime "github.com/ajankovic/smpp/time"
@@ -29,7 +30,11 @@ type DeliverSm struct {
 	DataCoding           int
 	SmDefaultMsgID       int
 	ShortMessage         string
-	Options              *Options
+	// ShortMessageBytes holds raw message content. When not nil it takes
+	// precedence over ShortMessage during encoding. Decoding always sets
+	// ShortMessage so use Message to get raw content regardless of the field.
+	ShortMessageBytes []byte
+	Options           *Options
 }
 
 // CommandID implements pdu.PDU interface.
@@ -44,8 +49,52 @@ func (p DeliverSm) Response(msgID string) *DeliverSmResp {
 	}
 }
 
+// IsDeliveryReceipt reports whether esm_class marks the message as SMSC
+// delivery receipt or intermediate notification instead of mobile originated
+// message.
+func (p DeliverSm) IsDeliveryReceipt() bool {
+	return p.EsmClass.Type == DelRecEsmType || p.EsmClass.Type == IDNEsmType
+}
+
+// ReceiptedMessageID returns id of the message this delivery receipt refers to.
+// The receipted_message_id option takes precedence and the id from the receipt
+// text is used only when the option is missing. Returned id is lower cased so
+// hex ids can be compared regardless of formatting. Empty string is returned
+// when id can't be found.
+func (p DeliverSm) ReceiptedMessageID() string {
+	text := p.ShortMessage
+	if p.Options != nil {
+		if id := p.Options.ReceiptedMessageID(); id != "" {
+			return strings.ToLower(id)
+		}
+		if text == "" {
+			text = p.Options.MessagePayload()
+		}
+	}
+	rec, err := ParseDeliveryReceipt(text)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(rec.Id)
+}
+
+// Message returns raw message content. ShortMessageBytes is returned when set,
+// otherwise bytes of ShortMessage.
+func (p DeliverSm) Message() []byte {
+	if p.ShortMessageBytes != nil {
+		return p.ShortMessageBytes
+	}
+	return []byte(p.ShortMessage)
+}
+
 // MarshalBinary implements encoding.BinaryMarshaler interface.
 func (p DeliverSm) MarshalBinary() ([]byte, error) {
+	if len(p.ServiceType) > 5 {
+		return nil, fmt.Errorf("smpp/pdu: service_type %q longer than 5 characters", p.ServiceType)
+	}
+	if err := p.EsmClass.Validate(); err != nil {
+		return nil, err
+	}
 	out := append(
 		[]byte(p.ServiceType),
 		0,
@@ -66,11 +115,9 @@ func (p DeliverSm) MarshalBinary() ([]byte, error) {
 		return nil, err
 	}
 	out = append(out, tm...)
-	l := len(p.ShortMessage)
-	out = append(out, p.RegisteredDelivery.Byte(), byte(p.ReplaceIfPresentFlag), byte(p.DataCoding), byte(p.SmDefaultMsgID), byte(l))
-	if l > 0 {
-		out = append(out, []byte(p.ShortMessage)...)
-	}
+	sm := p.Message()
+	out = append(out, p.RegisteredDelivery.Byte(), byte(p.ReplaceIfPresentFlag), byte(p.DataCoding), byte(p.SmDefaultMsgID), byte(len(sm)))
+	out = append(out, sm...)
 	if p.Options == nil {
 		return out, nil
 	}
@@ -83,10 +130,19 @@ func (p DeliverSm) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary implements encoding.BinaryUnmarshaler interface.
 func (p *DeliverSm) UnmarshalBinary(body []byte) error {
+	return p.unmarshal(body, false)
+}
+
+func (p *DeliverSm) unmarshalLenient(body []byte) error {
+	return p.unmarshal(body, true)
+}
+
+func (p *DeliverSm) unmarshal(body []byte, lenient bool) error {
 	if len(body) < 25 {
 		return fmt.Errorf("smpp/pdu: deliver_sm body too short: %d", len(body))
 	}
 	buf := newBuffer(body)
+	buf.lenient = lenient
 	res, err := buf.ReadCString(6)
 	if err != nil {
 		return fmt.Errorf("smpp/pdu: decoding service_type %s", err)
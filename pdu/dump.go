@@ -0,0 +1,261 @@
+package pdu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type tlvKind int
+
+const (
+	tlvOctets tlvKind = iota
+	tlvInt
+	tlvCString
+	tlvString
+)
+
+// tlvKinds describes how known TLV values should be rendered.
+var tlvKinds = map[TagID]tlvKind{
+	TagDestAddrSubUnit:        tlvInt,
+	TagDestNetworkType:        tlvInt,
+	TagDestBearerType:         tlvInt,
+	TagDestTelematicsID:       tlvInt,
+	TagSourceAddrSubunit:      tlvInt,
+	TagSourceNetworkType:      tlvInt,
+	TagSourceBearerType:       tlvInt,
+	TagSourceTelematicsID:     tlvInt,
+	TagQosTimeToLive:          tlvInt,
+	TagPayloadType:            tlvInt,
+	TagAdditionalStatusInfoTe: tlvCString,
+	TagReceiptedMessageID:     tlvCString,
+	TagMsMsgWaitFacilities:    tlvInt,
+	TagPrivacyIndicator:       tlvInt,
+	TagUserMessageReference:   tlvInt,
+	TagUserResponseCode:       tlvInt,
+	TagSourcePort:             tlvInt,
+	TagDestinationPort:        tlvInt,
+	TagSarMsgRefNum:           tlvInt,
+	TagLanguageIndicator:      tlvInt,
+	TagSarTotalSegments:       tlvInt,
+	TagSarSegmentSeqnum:       tlvInt,
+	TagScInterfaceVersion:     tlvInt,
+	TagCallbackNumPresInd:     tlvInt,
+	TagNumberOfMessages:       tlvInt,
+	TagDpfResult:              tlvInt,
+	TagSetDPF:                 tlvInt,
+	TagMsAvailabilityStatus:   tlvInt,
+	TagMessagePayload:         tlvString,
+	TagDeliveryFailureReason:  tlvInt,
+	TagMoreMessagesToSend:     tlvInt,
+	TagMessageState:           tlvInt,
+	TagUssdServiceOp:          tlvInt,
+	TagDisplayTime:            tlvInt,
+	TagSmsSignal:              tlvInt,
+	TagMsValidity:             tlvInt,
+	TagAlertOnMessageDeliv:    tlvInt,
+	TagItsReplyType:           tlvInt,
+	TagItsSessionInfo:         tlvInt,
+}
+
+// tagNames maps known tags to their names from the specification.
+var tagNames = map[TagID]string{
+	TagDestAddrSubUnit:        "dest_addr_subunit",
+	TagDestNetworkType:        "dest_network_type",
+	TagDestBearerType:         "dest_bearer_type",
+	TagDestTelematicsID:       "dest_telematics_id",
+	TagSourceAddrSubunit:      "source_addr_subunit",
+	TagSourceNetworkType:      "source_network_type",
+	TagSourceBearerType:       "source_bearer_type",
+	TagSourceTelematicsID:     "source_telematics_id",
+	TagQosTimeToLive:          "qos_time_to_live",
+	TagPayloadType:            "payload_type",
+	TagAdditionalStatusInfoTe: "additional_status_info_text",
+	TagReceiptedMessageID:     "receipted_message_id",
+	TagMsMsgWaitFacilities:    "ms_msg_wait_facilities",
+	TagPrivacyIndicator:       "privacy_indicator",
+	TagSourceSubaddress:       "source_subaddress",
+	TagDestSubaddress:         "dest_subaddress",
+	TagUserMessageReference:   "user_message_reference",
+	TagUserResponseCode:       "user_response_code",
+	TagSourcePort:             "source_port",
+	TagDestinationPort:        "destination_port",
+	TagSarMsgRefNum:           "sar_msg_ref_num",
+	TagLanguageIndicator:      "language_indicator",
+	TagSarTotalSegments:       "sar_total_segments",
+	TagSarSegmentSeqnum:       "sar_segment_seqnum",
+	TagScInterfaceVersion:     "sc_interface_version",
+	TagCallbackNumPresInd:     "callback_num_pres_ind",
+	TagCallbackNumA:           "callback_num_atag",
+	TagNumberOfMessages:       "number_of_messages",
+	TagCallbackNum:            "callback_num",
+	TagDpfResult:              "dpf_result",
+	TagSetDPF:                 "set_dpf",
+	TagMsAvailabilityStatus:   "ms_availability_status",
+	TagNetworkErrorCode:       "network_error_code",
+	TagMessagePayload:         "message_payload",
+	TagDeliveryFailureReason:  "delivery_failure_reason",
+	TagMoreMessagesToSend:     "more_messages_to_send",
+	TagMessageState:           "message_state",
+	TagUssdServiceOp:          "ussd_service_op",
+	TagDisplayTime:            "display_time",
+	TagSmsSignal:              "sms_signal",
+	TagMsValidity:             "ms_validity",
+	TagAlertOnMessageDeliv:    "alert_on_message_delivery",
+	TagItsReplyType:           "its_reply_type",
+	TagItsSessionInfo:         "its_session_info",
+}
+
+// OptionDesc describes single optional parameter.
+type OptionDesc struct {
+	Tag TagID
+	// Name is the parameter name from the specification or hexadecimal
+	// tag value for unknown tags.
+	Name string
+	Raw  []byte
+	// Value is decoded value of the known tags, int for integers and
+	// string for strings. It's nil if value can't be decoded.
+	Value interface{}
+}
+
+// DescribeOptions lists all optional parameters ordered by tag with their
+// names and decoded values.
+func DescribeOptions(o *Options) []OptionDesc {
+	if o == nil {
+		return nil
+	}
+	tags := make([]int, 0, len(o.fields))
+	for tag := range o.fields {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	var out []OptionDesc
+	for _, t := range tags {
+		tag := TagID(t)
+		name, ok := tagNames[tag]
+		if !ok {
+			name = fmt.Sprintf("0x%04X", t)
+		}
+		for _, val := range o.GetAll(tag) {
+			out = append(out, OptionDesc{
+				Tag:   tag,
+				Name:  name,
+				Raw:   val,
+				Value: tlvValue(tag, val),
+			})
+		}
+	}
+	return out
+}
+
+// tlvValue decodes value of the known tag.
+func tlvValue(tag TagID, val []byte) interface{} {
+	switch tlvKinds[tag] {
+	case tlvInt:
+		switch len(val) {
+		case 1:
+			return int(val[0])
+		case 2:
+			return int(binary.BigEndian.Uint16(val))
+		case 4:
+			return int(binary.BigEndian.Uint32(val))
+		}
+	case tlvCString:
+		if l := len(val); l > 0 && val[l-1] == 0 {
+			return string(val[:l-1])
+		}
+	case tlvString:
+		return string(val)
+	}
+	return nil
+}
+
+// Dump renders PDU in human readable form suitable for logging.
+// Known TLV values are decoded instead of printed as raw bytes.
+func Dump(p PDU) string {
+	if p == nil {
+		return "<nil>"
+	}
+	v := reflect.ValueOf(p)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		v = v.Elem()
+	}
+	var sb strings.Builder
+	sb.WriteString(v.Type().Name())
+	sb.WriteByte('{')
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(v.Type().Field(i).Name)
+			sb.WriteByte(':')
+			dumpValue(&sb, v.Field(i))
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func dumpValue(sb *strings.Builder, v reflect.Value) {
+	if !v.CanInterface() {
+		fmt.Fprintf(sb, "%v", v)
+		return
+	}
+	switch val := v.Interface().(type) {
+	case *Options:
+		dumpOptions(sb, val)
+	case time.Time:
+		if val.IsZero() {
+			sb.WriteString("-")
+		} else {
+			sb.WriteString(val.Format(time.RFC3339))
+		}
+	case string:
+		fmt.Fprintf(sb, "%q", val)
+	default:
+		fmt.Fprintf(sb, "%+v", val)
+	}
+}
+
+func dumpOptions(sb *strings.Builder, o *Options) {
+	if o == nil {
+		sb.WriteString("<nil>")
+		return
+	}
+	tags := make([]int, 0, len(o.fields))
+	for tag := range o.fields {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	sb.WriteByte('{')
+	for i, t := range tags {
+		tag := TagID(t)
+		for j, val := range o.GetAll(tag) {
+			if i > 0 || j > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(tag.String())
+			sb.WriteByte(':')
+			dumpTLV(sb, tag, val)
+		}
+	}
+	sb.WriteByte('}')
+}
+
+func dumpTLV(sb *strings.Builder, tag TagID, val []byte) {
+	switch v := tlvValue(tag, val).(type) {
+	case int:
+		fmt.Fprintf(sb, "%d", v)
+	case string:
+		fmt.Fprintf(sb, "%q", v)
+	default:
+		fmt.Fprintf(sb, "% X", val)
+	}
+}
@@ -0,0 +1,72 @@
+package pdu
+
+import "errors"
+
+var (
+	// ErrFraming is the category of decoding errors caused by invalid PDU
+	// framing, like command_length out of bounds. Stream position can't be
+	// trusted after framing error.
+	ErrFraming = errors.New("smpp/pdu: framing error")
+	// ErrBodyDecode is the category of decoding errors caused by malformed
+	// PDU body. Whole PDU was consumed so decoding can continue.
+	ErrBodyDecode = errors.New("smpp/pdu: body decode error")
+	// ErrUnknownCommand is wrapped by DecodeError of ErrBodyDecode kind when
+	// received PDU has unsupported command_id.
+	ErrUnknownCommand = errors.New("smpp/pdu: unknown command_id")
+)
+
+// DecodeError is returned by Decoder when read data can't be decoded.
+// Use errors.Is with ErrFraming or ErrBodyDecode to check its category.
+type DecodeError struct {
+	// Kind is either ErrFraming or ErrBodyDecode.
+	Kind error
+	Err  error
+}
+
+// Error implements error interface.
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the category of the error.
+func (e *DecodeError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Temporary reports whether decoding can continue after the error.
+func (e *DecodeError) Temporary() bool {
+	return e.Kind == ErrBodyDecode
+}
+
+// TransportError is returned by Decoder when reading from the underlying
+// reader fails, including connection closed in the middle of the PDU.
+type TransportError struct {
+	Err error
+}
+
+// Error implements error interface.
+func (e *TransportError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns underlying error.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether underlying error is temporary.
+func (e *TransportError) Temporary() bool {
+	t, ok := e.Err.(interface{ Temporary() bool })
+	return ok && t.Temporary()
+}
+
+// Timeout reports whether underlying error is timeout.
+func (e *TransportError) Timeout() bool {
+	t, ok := e.Err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
@@ -15,6 +15,16 @@ type Header interface {
 	Sequence() uint32
 }
 
+// NewHeader creates PDU header with provided values. Length is left
+// unset as it is calculated during encoding.
+func NewHeader(id CommandID, status Status, seq uint32) Header {
+	return &header{
+		commandID: id,
+		status:    status,
+		sequence:  seq,
+	}
+}
+
 type header struct {
 	length    uint32
 	commandID CommandID
@@ -41,9 +51,6 @@ func (h *header) UnmarshalBinary(body []byte) error {
 	if h.length < 16 {
 		return errors.New("smpp: pdu length under lower limit")
 	}
-	if h.length > MaxPDUSize {
-		return errors.New("smpp: pdu length over upper limit")
-	}
 	h.commandID = CommandID(binary.BigEndian.Uint32(body[4:8]))
 	h.status = Status(binary.BigEndian.Uint32(body[8:12]))
 	h.sequence = binary.BigEndian.Uint32(body[12:16])
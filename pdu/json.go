@@ -0,0 +1,305 @@
+package pdu
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// tlvIntSizes holds lengths of integer TLV values defined by the
+// specification so they can be encoded back from JSON numbers.
+var tlvIntSizes = map[TagID]int{
+	TagDestAddrSubUnit:       1,
+	TagDestNetworkType:       1,
+	TagDestBearerType:        1,
+	TagDestTelematicsID:      2,
+	TagSourceAddrSubunit:     1,
+	TagSourceNetworkType:     1,
+	TagSourceBearerType:      1,
+	TagSourceTelematicsID:    1,
+	TagQosTimeToLive:         4,
+	TagPayloadType:           1,
+	TagMsMsgWaitFacilities:   1,
+	TagPrivacyIndicator:      1,
+	TagUserMessageReference:  2,
+	TagUserResponseCode:      1,
+	TagSourcePort:            2,
+	TagDestinationPort:       2,
+	TagSarMsgRefNum:          2,
+	TagLanguageIndicator:     1,
+	TagSarTotalSegments:      1,
+	TagSarSegmentSeqnum:      1,
+	TagScInterfaceVersion:    1,
+	TagCallbackNumPresInd:    1,
+	TagNumberOfMessages:      1,
+	TagDpfResult:             1,
+	TagSetDPF:                1,
+	TagMsAvailabilityStatus:  1,
+	TagDeliveryFailureReason: 1,
+	TagMoreMessagesToSend:    1,
+	TagMessageState:          1,
+	TagUssdServiceOp:         1,
+	TagDisplayTime:           1,
+	TagSmsSignal:             2,
+	TagMsValidity:            1,
+	TagItsReplyType:          1,
+	TagItsSessionInfo:        2,
+}
+
+// tagsByName maps specification names back to tags.
+var tagsByName = func() map[string]TagID {
+	out := make(map[string]TagID, len(tagNames))
+	for tag, name := range tagNames {
+		out[name] = tag
+	}
+	return out
+}()
+
+// commandIDsByName maps command names back to command ids.
+var commandIDsByName = func() map[string]CommandID {
+	out := map[string]CommandID{
+		GenericNackID.String():       GenericNackID,
+		OutbindID.String():           OutbindID,
+		AlertNotificationID.String(): AlertNotificationID,
+	}
+	for req, resp := range responseIDs {
+		out[req.String()] = req
+		out[resp.String()] = resp
+	}
+	return out
+}()
+
+// octetFields lists PDU fields holding raw octets in Go strings. They are
+// rendered as hex strings since JSON strings can't carry invalid UTF-8.
+var octetFields = []string{"ShortMessage"}
+
+// jsonPDU is JSON envelope used by ToJSON and FromJSON.
+type jsonPDU struct {
+	CommandID string          `json:"command_id"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// ToJSON renders PDU as JSON object holding command name and PDU fields.
+// Options are rendered as map of parameter names to decoded values and
+// short_message as hex string so binary and UCS2 content is preserved. Use
+// FromJSON to reconstruct the PDU.
+func ToJSON(p PDU) ([]byte, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if v := structValue(p); v.IsValid() {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, err
+		}
+		for _, name := range octetFields {
+			f := v.FieldByName(name)
+			if !f.IsValid() || f.Kind() != reflect.String {
+				continue
+			}
+			if fields[name], err = json.Marshal(hex.EncodeToString([]byte(f.String()))); err != nil {
+				return nil, err
+			}
+		}
+		if body, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(jsonPDU{
+		CommandID: p.CommandID().String(),
+		Body:      body,
+	})
+}
+
+// FromJSON reconstructs PDU from JSON created by ToJSON.
+func FromJSON(data []byte) (PDU, error) {
+	var env jsonPDU
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	id, ok := commandIDsByName[env.CommandID]
+	if !ok {
+		return nil, fmt.Errorf("smpp/pdu: unknown command %q", env.CommandID)
+	}
+	p := NewPDU(id)
+	if len(env.Body) == 0 {
+		return p, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(env.Body, &fields); err != nil {
+		return nil, err
+	}
+	octets := make(map[string][]byte)
+	for _, name := range octetFields {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("smpp/pdu: invalid %s: %v", name, err)
+		}
+		octets[name] = b
+		delete(fields, name)
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, p); err != nil {
+		return nil, err
+	}
+	v := structValue(p)
+	for name, b := range octets {
+		if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String {
+			f.SetString(string(b))
+		}
+	}
+	return p, nil
+}
+
+// structValue returns struct value behind the PDU pointer.
+func structValue(p PDU) reflect.Value {
+	v := reflect.ValueOf(p)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return v
+}
+
+// MarshalJSON implements json.Marshaler interface. Options are rendered
+// as object with parameter names as keys. Integers and C-Octet strings of
+// known tags are decoded while other values, including message_payload,
+// are rendered as hex strings. Repeated tags are rendered as arrays.
+func (o *Options) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(o.fields))
+	for tag := range o.fields {
+		name, ok := tagNames[tag]
+		if !ok {
+			name = fmt.Sprintf("0x%04X", int(tag))
+		}
+		vals := o.GetAll(tag)
+		if len(vals) == 1 {
+			out[name] = tlvJSON(tag, vals[0])
+			continue
+		}
+		all := make([]interface{}, len(vals))
+		for i, val := range vals {
+			all[i] = tlvJSON(tag, val)
+		}
+		out[name] = all
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *Options) UnmarshalJSON(data []byte) error {
+	var in map[string]json.RawMessage
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	o.fields = make(map[TagID][]byte, len(in))
+	o.repeated = nil
+	for name, raw := range in {
+		tag, err := tagByName(name)
+		if err != nil {
+			return err
+		}
+		raws := []json.RawMessage{raw}
+		if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+			raws = nil
+			if err := json.Unmarshal(raw, &raws); err != nil {
+				return err
+			}
+		}
+		for i, r := range raws {
+			val, err := tlvFromJSON(tag, r)
+			if err != nil {
+				return fmt.Errorf("smpp/pdu: invalid value of %s: %v", name, err)
+			}
+			if i == 0 {
+				o.fields[tag] = val
+				continue
+			}
+			if o.repeated == nil {
+				o.repeated = make(map[TagID][][]byte)
+			}
+			o.repeated[tag] = append(o.repeated[tag], val)
+		}
+	}
+	return nil
+}
+
+func tagByName(name string) (TagID, error) {
+	if tag, ok := tagsByName[name]; ok {
+		return tag, nil
+	}
+	if strings.HasPrefix(name, "0x") {
+		if v, err := strconv.ParseUint(name[2:], 16, 16); err == nil {
+			return TagID(v), nil
+		}
+	}
+	return 0, fmt.Errorf("smpp/pdu: unknown optional parameter %q", name)
+}
+
+// tlvJSON converts TLV value into its JSON representation.
+func tlvJSON(tag TagID, val []byte) interface{} {
+	switch tlvKinds[tag] {
+	case tlvInt:
+		if size, ok := tlvIntSizes[tag]; ok && size == len(val) {
+			return tlvValue(tag, val)
+		}
+	case tlvCString:
+		if v := tlvValue(tag, val); v != nil {
+			return v
+		}
+		return string(val)
+	}
+	return hex.EncodeToString(val)
+}
+
+// tlvFromJSON converts JSON representation back into TLV value.
+func tlvFromJSON(tag TagID, raw json.RawMessage) ([]byte, error) {
+	var s string
+	switch tlvKinds[tag] {
+	case tlvInt:
+		size, ok := tlvIntSizes[tag]
+		if !ok || strings.HasPrefix(string(raw), `"`) {
+			break
+		}
+		var v uint32
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		if size < 4 && v >= 1<<(8*uint(size)) {
+			return nil, fmt.Errorf("%d doesn't fit into %d bytes", v, size)
+		}
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return b[4-size:], nil
+	case tlvCString:
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return append([]byte(s), 0), nil
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,70 @@
+package pdu
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTripSubmitSm(t *testing.T) {
+	p := &SubmitSm{
+		SourceAddr:         "ACME",
+		DestinationAddr:    "38160123456",
+		RegisteredDelivery: RegisteredDelivery{Receipt: YesDeliveryReceipt},
+		ShortMessage:       "Hello",
+		Options: NewOptions().
+			SetUserMessageReference(42).
+			Set(TagID(0x1401), []byte{0xCA, 0xFE}),
+	}
+	b, err := ToJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"command_id":"SubmitSmID"`,
+		`"user_message_reference":42`,
+		`"0x1401":"cafe"`,
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("ToJSON() => %s expected to contain %s", b, expected)
+		}
+	}
+	got, err := FromJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("FromJSON() => %+v expected %+v", got, p)
+	}
+	if ref := got.(*SubmitSm).Options.UserMessageReference(); ref != 42 {
+		t.Errorf("UserMessageReference() => %d expected 42", ref)
+	}
+	if _, err := FromJSON([]byte(`{"command_id":"Unknown"}`)); err == nil {
+		t.Errorf("expected error for unknown command")
+	}
+}
+
+func TestJSONRoundTripUCS2(t *testing.T) {
+	// UCS2 content isn't valid UTF-8 so it would be mangled as JSON string.
+	p := &DeliverSm{
+		SourceAddr:      "38160123456",
+		DestinationAddr: "ACME",
+		DataCoding:      DataCodingUCS2,
+		ShortMessage:    "\x04\x1f\xd8=",
+		Options:         NewOptions().SetMessagePayload("\x00\xff\xd8\x3d"),
+	}
+	b, err := ToJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"ShortMessage":"041fd83d"`) {
+		t.Errorf("ToJSON() => %s expected hex short message", b)
+	}
+	got, err := FromJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("FromJSON() => %+v expected %+v", got, p)
+	}
+}
@@ -68,22 +68,6 @@ func (p *CancelSmResp) UnmarshalBinary(body []byte) error {
 	return fmt.Errorf("Command %s is not supported yet", p.CommandID())
 }
 
-// Outbind Not supported yet.
-type Outbind struct {
-}
-
-func (p Outbind) CommandID() CommandID {
-	return OutbindID
-}
-
-func (p Outbind) MarshalBinary() ([]byte, error) {
-	return nil, fmt.Errorf("Command %s is not supported yet", p.CommandID())
-}
-
-func (p *Outbind) UnmarshalBinary(body []byte) error {
-	return fmt.Errorf("Command %s is not supported yet", p.CommandID())
-}
-
 // SubmitMulti Not supported yet.
 type SubmitMulti struct {
 }
@@ -116,22 +100,6 @@ func (p *SubmitMultiResp) UnmarshalBinary(body []byte) error {
 	return fmt.Errorf("Command %s is not supported yet", p.CommandID())
 }
 
-// AlertNotification Not supported yet.
-type AlertNotification struct {
-}
-
-func (p AlertNotification) CommandID() CommandID {
-	return AlertNotificationID
-}
-
-func (p AlertNotification) MarshalBinary() ([]byte, error) {
-	return nil, fmt.Errorf("Command %s is not supported yet", p.CommandID())
-}
-
-func (p *AlertNotification) UnmarshalBinary(body []byte) error {
-	return fmt.Errorf("Command %s is not supported yet", p.CommandID())
-}
-
 // DataSm Not supported yet.
 type DataSm struct {
 }
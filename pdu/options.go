@@ -10,6 +10,9 @@ import (
 // by the users.
 type Options struct {
 	fields map[TagID][]byte
+	// repeated holds occurrences of the tag after the first one when
+	// decoded TLVs repeat the same tag.
+	repeated map[TagID][][]byte
 }
 
 // NewOptions creates new options map.
@@ -19,49 +22,63 @@ func NewOptions() *Options {
 	}
 }
 
-// Set assigns new TLV field.
+// Set assigns new TLV field replacing all previous occurrences of the tag.
 func (o *Options) Set(tag TagID, val []byte) *Options {
 	o.fields[tag] = val
+	delete(o.repeated, tag)
 	return o
 }
 
 // SetSingle assigns new TLV field with one byte value.
 func (o *Options) SetSingle(tag TagID, val int) *Options {
-	o.fields[tag] = []byte{byte(val)}
-	return o
+	return o.Set(tag, []byte{byte(val)})
 }
 
 // SetDouble assigns new TLV field with two bytes value.
 func (o *Options) SetDouble(tag TagID, val int) *Options {
 	b := make([]byte, 2)
 	binary.BigEndian.PutUint16(b, uint16(val))
-	o.fields[tag] = b
-	return o
+	return o.Set(tag, b)
+}
+
+// SetQuad assigns new TLV field with four bytes value.
+func (o *Options) SetQuad(tag TagID, val int) *Options {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(val))
+	return o.Set(tag, b)
 }
 
 // SetString assigns new TLV field with string value.
 func (o *Options) SetString(tag TagID, val string) *Options {
-	o.fields[tag] = []byte(val)
-	return o
+	return o.Set(tag, []byte(val))
 }
 
 // SetCString assigns new TLV field with string value.
 func (o *Options) SetCString(tag TagID, val string) *Options {
-	o.fields[tag] = append([]byte(val), 0)
-	return o
+	return o.Set(tag, append([]byte(val), 0))
 }
 
 // Get tries to get byte value out of TLV field if present. If it's not it
-// returns ok as false.
+// returns ok as false. If tag is repeated the first occurrence is returned.
 func (o *Options) Get(tag TagID) ([]byte, bool) {
 	val, ok := o.fields[tag]
 	return val, ok
 }
 
+// GetAll returns values of all occurrences of the tag in order they were
+// decoded. It returns nil if tag isn't present.
+func (o *Options) GetAll(tag TagID) [][]byte {
+	val, ok := o.fields[tag]
+	if !ok {
+		return nil
+	}
+	return append([][]byte{val}, o.repeated[tag]...)
+}
+
 // GetSingle returns tag value as one byte integer.
 func (o *Options) GetSingle(tag TagID) (int, bool) {
 	val, ok := o.fields[tag]
-	if !ok {
+	if !ok || len(val) < 1 {
 		return 0, false
 	}
 	return int(val[0]), true
@@ -70,12 +87,21 @@ func (o *Options) GetSingle(tag TagID) (int, bool) {
 // GetDouble returns tag value as two byte integer.
 func (o *Options) GetDouble(tag TagID) (int, bool) {
 	b, ok := o.fields[tag]
-	if !ok {
+	if !ok || len(b) < 2 {
 		return 0, false
 	}
 	return int(binary.BigEndian.Uint16(b)), true
 }
 
+// GetQuad returns tag value as four byte integer.
+func (o *Options) GetQuad(tag TagID) (int, bool) {
+	b, ok := o.fields[tag]
+	if !ok || len(b) != 4 {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint32(b)), true
+}
+
 // GetString returns tag value as string.
 func (o *Options) GetString(tag TagID) (string, bool) {
 	b, ok := o.fields[tag]
@@ -166,6 +192,125 @@ func (o *Options) ReceiptedMessageID() string {
 	return val
 }
 
+// UssdServiceOp is helper function for getting this option.
+func (o *Options) UssdServiceOp() (int, bool) {
+	return o.GetSingle(TagUssdServiceOp)
+}
+
+// MoreMessagesToSend is helper function for getting this option.
+func (o *Options) MoreMessagesToSend() (bool, bool) {
+	val, ok := o.GetSingle(TagMoreMessagesToSend)
+	return val == 1, ok
+}
+
+// NetworkErrorCode is helper function for getting this option.
+// It returns network type and network specific error code.
+func (o *Options) NetworkErrorCode() (int, int, bool) {
+	val, ok := o.fields[TagNetworkErrorCode]
+	if !ok || len(val) != 3 {
+		return 0, 0, false
+	}
+	return int(val[0]), int(binary.BigEndian.Uint16(val[1:])), true
+}
+
+// SourceSubaddress is helper function for getting this option.
+// It returns subaddress type and subaddress data.
+func (o *Options) SourceSubaddress() (int, []byte, bool) {
+	return o.subaddress(TagSourceSubaddress)
+}
+
+// DestSubaddress is helper function for getting this option.
+// It returns subaddress type and subaddress data.
+func (o *Options) DestSubaddress() (int, []byte, bool) {
+	return o.subaddress(TagDestSubaddress)
+}
+
+func (o *Options) subaddress(tag TagID) (int, []byte, bool) {
+	val, ok := o.fields[tag]
+	if !ok || len(val) < 1 {
+		return 0, nil, false
+	}
+	return int(val[0]), val[1:], true
+}
+
+// SourceNetworkType is helper function for getting this option.
+func (o *Options) SourceNetworkType() (int, bool) {
+	return o.GetSingle(TagSourceNetworkType)
+}
+
+// DestNetworkType is helper function for getting this option.
+func (o *Options) DestNetworkType() (int, bool) {
+	return o.GetSingle(TagDestNetworkType)
+}
+
+// SourceBearerType is helper function for getting this option.
+func (o *Options) SourceBearerType() (int, bool) {
+	return o.GetSingle(TagSourceBearerType)
+}
+
+// DestBearerType is helper function for getting this option.
+func (o *Options) DestBearerType() (int, bool) {
+	return o.GetSingle(TagDestBearerType)
+}
+
+// LanguageIndicator is helper function for getting this option.
+func (o *Options) LanguageIndicator() (int, bool) {
+	return o.GetSingle(TagLanguageIndicator)
+}
+
+// ItsReplyType is helper function for getting this option.
+func (o *Options) ItsReplyType() (int, bool) {
+	return o.GetSingle(TagItsReplyType)
+}
+
+// ItsSessionInfo is helper function for getting this option.
+// It returns session number, sequence number and end of session indicator.
+func (o *Options) ItsSessionInfo() (session, seq int, end, ok bool) {
+	val, ok := o.fields[TagItsSessionInfo]
+	if !ok || len(val) != 2 {
+		return 0, 0, false, false
+	}
+	return int(val[0]), int(val[1] >> 1), val[1]&1 == 1, true
+}
+
+// PrivacyIndicator is helper function for getting this option.
+func (o *Options) PrivacyIndicator() (int, bool) {
+	return o.GetSingle(TagPrivacyIndicator)
+}
+
+// PayloadType is helper function for getting this option.
+func (o *Options) PayloadType() (int, bool) {
+	return o.GetSingle(TagPayloadType)
+}
+
+// MsAvailabilityStatus is helper function for getting this option.
+func (o *Options) MsAvailabilityStatus() (int, bool) {
+	return o.GetSingle(TagMsAvailabilityStatus)
+}
+
+// DisplayTime is helper function for getting this option.
+func (o *Options) DisplayTime() (int, bool) {
+	return o.GetSingle(TagDisplayTime)
+}
+
+// SmsSignal is helper function for getting this option.
+func (o *Options) SmsSignal() (int, bool) {
+	return o.GetDouble(TagSmsSignal)
+}
+
+// QosTimeToLive is helper function for getting this option.
+// It returns time to live in seconds.
+func (o *Options) QosTimeToLive() (int, bool) {
+	return o.GetQuad(TagQosTimeToLive)
+}
+
+// DpfResult is helper function for getting this option.
+// It returns true if delivery pending flag was set.
+func (o *Options) DpfResult() (bool, bool) {
+	val, ok := o.GetSingle(TagDpfResult)
+	return val == 1, ok
+}
+
 // SetUserMessageReference is helper function for setting this option.
 func (o *Options) SetUserMessageReference(val int) *Options {
 	return o.SetDouble(TagUserMessageReference, val)
@@ -206,15 +351,134 @@ func (o *Options) SetReceiptedMessageID(val string) *Options {
 	return o.SetCString(TagReceiptedMessageID, val)
 }
 
+// SetUssdServiceOp is helper function for setting this option.
+func (o *Options) SetUssdServiceOp(val int) *Options {
+	return o.SetSingle(TagUssdServiceOp, val)
+}
+
+// SetMoreMessagesToSend is helper function for setting this option.
+func (o *Options) SetMoreMessagesToSend(val bool) *Options {
+	if val {
+		return o.SetSingle(TagMoreMessagesToSend, 1)
+	}
+	return o.SetSingle(TagMoreMessagesToSend, 0)
+}
+
+// SetNetworkErrorCode is helper function for setting this option.
+func (o *Options) SetNetworkErrorCode(netType, code int) *Options {
+	val := make([]byte, 3)
+	val[0] = byte(netType)
+	binary.BigEndian.PutUint16(val[1:], uint16(code))
+	return o.Set(TagNetworkErrorCode, val)
+}
+
+// SetSourceSubaddress is helper function for setting this option.
+func (o *Options) SetSourceSubaddress(typ int, data []byte) *Options {
+	return o.setSubaddress(TagSourceSubaddress, typ, data)
+}
+
+// SetDestSubaddress is helper function for setting this option.
+func (o *Options) SetDestSubaddress(typ int, data []byte) *Options {
+	return o.setSubaddress(TagDestSubaddress, typ, data)
+}
+
+func (o *Options) setSubaddress(tag TagID, typ int, data []byte) *Options {
+	val := make([]byte, 1+len(data))
+	val[0] = byte(typ)
+	copy(val[1:], data)
+	return o.Set(tag, val)
+}
+
+// SetSourceNetworkType is helper function for setting this option.
+func (o *Options) SetSourceNetworkType(network int) *Options {
+	return o.SetSingle(TagSourceNetworkType, network)
+}
+
+// SetDestNetworkType is helper function for setting this option.
+func (o *Options) SetDestNetworkType(network int) *Options {
+	return o.SetSingle(TagDestNetworkType, network)
+}
+
+// SetSourceBearerType is helper function for setting this option.
+func (o *Options) SetSourceBearerType(bearer int) *Options {
+	return o.SetSingle(TagSourceBearerType, bearer)
+}
+
+// SetDestBearerType is helper function for setting this option.
+func (o *Options) SetDestBearerType(bearer int) *Options {
+	return o.SetSingle(TagDestBearerType, bearer)
+}
+
+// SetLanguageIndicator is helper function for setting this option.
+func (o *Options) SetLanguageIndicator(lang int) *Options {
+	return o.SetSingle(TagLanguageIndicator, lang)
+}
+
+// SetItsReplyType is helper function for setting this option.
+func (o *Options) SetItsReplyType(t int) *Options {
+	return o.SetSingle(TagItsReplyType, t)
+}
+
+// SetItsSessionInfo is helper function for setting this option.
+// Sequence number is packed into bits 7..1 of the second octet and
+// end of session indicator into bit 0.
+func (o *Options) SetItsSessionInfo(session, seq int, end bool) *Options {
+	b := byte(seq << 1)
+	if end {
+		b |= 1
+	}
+	return o.Set(TagItsSessionInfo, []byte{byte(session), b})
+}
+
+// SetPrivacyIndicator is helper function for setting this option.
+func (o *Options) SetPrivacyIndicator(level int) *Options {
+	return o.SetSingle(TagPrivacyIndicator, level)
+}
+
+// SetPayloadType is helper function for setting this option.
+func (o *Options) SetPayloadType(t int) *Options {
+	return o.SetSingle(TagPayloadType, t)
+}
+
+// SetMsAvailabilityStatus is helper function for setting this option.
+func (o *Options) SetMsAvailabilityStatus(val int) *Options {
+	return o.SetSingle(TagMsAvailabilityStatus, val)
+}
+
+// SetDisplayTime is helper function for setting this option.
+func (o *Options) SetDisplayTime(mode int) *Options {
+	return o.SetSingle(TagDisplayTime, mode)
+}
+
+// SetSmsSignal is helper function for setting this option.
+func (o *Options) SetSmsSignal(val int) *Options {
+	return o.SetDouble(TagSmsSignal, val)
+}
+
+// SetQosTimeToLive is helper function for setting this option.
+func (o *Options) SetQosTimeToLive(seconds int) *Options {
+	return o.SetQuad(TagQosTimeToLive, seconds)
+}
+
+// SetDpfResult is helper function for setting this option.
+func (o *Options) SetDpfResult(set bool) *Options {
+	if set {
+		return o.SetSingle(TagDpfResult, 1)
+	}
+	return o.SetSingle(TagDpfResult, 0)
+}
+
 // MarshalBinary implements encoding.BinaryMarshaler interface.
 func (o *Options) MarshalBinary() ([]byte, error) {
 	var out []byte
-	for tag, val := range o.fields {
-		tlv := make([]byte, 4+len(val))
-		binary.BigEndian.PutUint16(tlv[:2], uint16(tag))
-		binary.BigEndian.PutUint16(tlv[2:4], uint16(len(val)))
-		copy(tlv[4:], val)
-		out = append(out, tlv...)
+	for tag := range o.fields {
+		for _, val := range o.GetAll(tag) {
+			tlv := make([]byte, 4+len(val))
+			binary.BigEndian.PutUint16(tlv[:2], uint16(tag))
+			binary.BigEndian.PutUint16(tlv[2:4], uint16(len(val)))
+			copy(tlv[4:], val)
+			out = append(out, tlv...)
+		}
 	}
 	return out, nil
 }
@@ -223,16 +487,40 @@ func (o *Options) MarshalBinary() ([]byte, error) {
 func (o *Options) UnmarshalBinary(buf []byte) error {
 	n := 0
 	for n < len(buf) {
-		if len(buf)-n <= 4 {
+		// Some SMSCs pad PDUs with null bytes which are ignored.
+		if zeros(buf[n:]) {
+			return nil
+		}
+		if len(buf)-n < 4 {
 			return fmt.Errorf("smpp/pdu: invalid optional body length")
 		}
 		tag := TagID(binary.BigEndian.Uint16(buf[n : n+2]))
 		l := int(binary.BigEndian.Uint16(buf[n+2 : n+4]))
-		if n+4+l >= len(buf)+1 {
+		if n+4+l > len(buf) {
 			return fmt.Errorf("smpp/pdu: invalid optional field length (%s %d)", tag, l)
 		}
-		o.fields[tag] = buf[n+4 : n+4+l]
+		// Copy value so options don't reference decoding buffer. Zero
+		// length values are stored as empty slices.
+		val := make([]byte, l)
+		copy(val, buf[n+4:n+4+l])
+		if _, ok := o.fields[tag]; ok {
+			if o.repeated == nil {
+				o.repeated = make(map[TagID][][]byte)
+			}
+			o.repeated[tag] = append(o.repeated[tag], val)
+		} else {
+			o.fields[tag] = val
+		}
 		n += 4 + l
 	}
 	return nil
 }
+
+func zeros(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -1 +1,292 @@
 package pdu
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestOptionsHelpers(t *testing.T) {
+	nsap := []byte{0x12, 0x34, 0x56}
+	for _, tc := range []struct {
+		tag TagID
+		set func(*Options) *Options
+		exp []byte
+		get func(*Options) (interface{}, bool)
+		val interface{}
+	}{
+		{
+			tag: TagUssdServiceOp,
+			set: func(o *Options) *Options { return o.SetUssdServiceOp(UssdOpUSSRRequest) },
+			exp: []byte{0x05, 0x01, 0x00, 0x01, 0x02},
+			get: func(o *Options) (interface{}, bool) { return o.UssdServiceOp() },
+			val: UssdOpUSSRRequest,
+		},
+		{
+			tag: TagMoreMessagesToSend,
+			set: func(o *Options) *Options { return o.SetMoreMessagesToSend(true) },
+			exp: []byte{0x04, 0x26, 0x00, 0x01, 0x01},
+			get: func(o *Options) (interface{}, bool) { return o.MoreMessagesToSend() },
+			val: true,
+		},
+		{
+			tag: TagMoreMessagesToSend,
+			set: func(o *Options) *Options { return o.SetMoreMessagesToSend(false) },
+			exp: []byte{0x04, 0x26, 0x00, 0x01, 0x00},
+			get: func(o *Options) (interface{}, bool) { return o.MoreMessagesToSend() },
+			val: false,
+		},
+		{
+			tag: TagPrivacyIndicator,
+			set: func(o *Options) *Options { return o.SetPrivacyIndicator(PrivacyConfidential) },
+			exp: []byte{0x02, 0x01, 0x00, 0x01, 0x02},
+			get: func(o *Options) (interface{}, bool) { return o.PrivacyIndicator() },
+			val: PrivacyConfidential,
+		},
+		{
+			tag: TagPayloadType,
+			set: func(o *Options) *Options { return o.SetPayloadType(PayloadTypeWCMP) },
+			exp: []byte{0x00, 0x19, 0x00, 0x01, 0x01},
+			get: func(o *Options) (interface{}, bool) { return o.PayloadType() },
+			val: PayloadTypeWCMP,
+		},
+		{
+			tag: TagDisplayTime,
+			set: func(o *Options) *Options { return o.SetDisplayTime(DisplayTimeInvoke) },
+			exp: []byte{0x12, 0x01, 0x00, 0x01, 0x02},
+			get: func(o *Options) (interface{}, bool) { return o.DisplayTime() },
+			val: DisplayTimeInvoke,
+		},
+		{
+			tag: TagSmsSignal,
+			set: func(o *Options) *Options { return o.SetSmsSignal(0x0102) },
+			exp: []byte{0x12, 0x03, 0x00, 0x02, 0x01, 0x02},
+			get: func(o *Options) (interface{}, bool) { return o.SmsSignal() },
+			val: 0x0102,
+		},
+		{
+			tag: TagQosTimeToLive,
+			set: func(o *Options) *Options { return o.SetQosTimeToLive(86400) },
+			exp: []byte{0x00, 0x17, 0x00, 0x04, 0x00, 0x01, 0x51, 0x80},
+			get: func(o *Options) (interface{}, bool) { return o.QosTimeToLive() },
+			val: 86400,
+		},
+		{
+			tag: TagDpfResult,
+			set: func(o *Options) *Options { return o.SetDpfResult(true) },
+			exp: []byte{0x04, 0x20, 0x00, 0x01, 0x01},
+			get: func(o *Options) (interface{}, bool) { return o.DpfResult() },
+			val: true,
+		},
+		{
+			tag: TagDpfResult,
+			set: func(o *Options) *Options { return o.SetDpfResult(false) },
+			exp: []byte{0x04, 0x20, 0x00, 0x01, 0x00},
+			get: func(o *Options) (interface{}, bool) { return o.DpfResult() },
+			val: false,
+		},
+		{
+			tag: TagSourceSubaddress,
+			set: func(o *Options) *Options { return o.SetSourceSubaddress(SubaddressNSAPEven, nsap) },
+			exp: []byte{0x02, 0x02, 0x00, 0x04, 0x80, 0x12, 0x34, 0x56},
+			get: func(o *Options) (interface{}, bool) {
+				typ, data, ok := o.SourceSubaddress()
+				return []interface{}{typ, data}, ok
+			},
+			val: []interface{}{SubaddressNSAPEven, nsap},
+		},
+		{
+			tag: TagDestSubaddress,
+			set: func(o *Options) *Options { return o.SetDestSubaddress(SubaddressNSAPOdd, nsap) },
+			exp: []byte{0x02, 0x03, 0x00, 0x04, 0x88, 0x12, 0x34, 0x56},
+			get: func(o *Options) (interface{}, bool) {
+				typ, data, ok := o.DestSubaddress()
+				return []interface{}{typ, data}, ok
+			},
+			val: []interface{}{SubaddressNSAPOdd, nsap},
+		},
+		{
+			tag: TagSourceNetworkType,
+			set: func(o *Options) *Options { return o.SetSourceNetworkType(NetworkGSM) },
+			exp: []byte{0x00, 0x0E, 0x00, 0x01, 0x01},
+			get: func(o *Options) (interface{}, bool) { return o.SourceNetworkType() },
+			val: NetworkGSM,
+		},
+		{
+			tag: TagDestNetworkType,
+			set: func(o *Options) *Options { return o.SetDestNetworkType(NetworkIS95) },
+			exp: []byte{0x00, 0x06, 0x00, 0x01, byte(NetworkIS95)},
+			get: func(o *Options) (interface{}, bool) { return o.DestNetworkType() },
+			val: NetworkIS95,
+		},
+		{
+			tag: TagSourceBearerType,
+			set: func(o *Options) *Options { return o.SetSourceBearerType(BearerSMS) },
+			exp: []byte{0x00, 0x0F, 0x00, 0x01, 0x01},
+			get: func(o *Options) (interface{}, bool) { return o.SourceBearerType() },
+			val: BearerSMS,
+		},
+		{
+			tag: TagDestBearerType,
+			set: func(o *Options) *Options { return o.SetDestBearerType(BearerPacketData) },
+			exp: []byte{0x00, 0x07, 0x00, 0x01, byte(BearerPacketData)},
+			get: func(o *Options) (interface{}, bool) { return o.DestBearerType() },
+			val: BearerPacketData,
+		},
+		{
+			tag: TagLanguageIndicator,
+			set: func(o *Options) *Options { return o.SetLanguageIndicator(LanguageGerman) },
+			exp: []byte{0x02, 0x0D, 0x00, 0x01, 0x04},
+			get: func(o *Options) (interface{}, bool) { return o.LanguageIndicator() },
+			val: LanguageGerman,
+		},
+		{
+			tag: TagItsReplyType,
+			set: func(o *Options) *Options { return o.SetItsReplyType(ItsReplyMenu) },
+			exp: []byte{0x13, 0x80, 0x00, 0x01, 0x05},
+			get: func(o *Options) (interface{}, bool) { return o.ItsReplyType() },
+			val: ItsReplyMenu,
+		},
+		{
+			// Sequence number 3 with end of session indicator set.
+			tag: TagItsSessionInfo,
+			set: func(o *Options) *Options { return o.SetItsSessionInfo(0x2A, 3, true) },
+			exp: []byte{0x13, 0x83, 0x00, 0x02, 0x2A, 0x07},
+			get: func(o *Options) (interface{}, bool) {
+				session, seq, end, ok := o.ItsSessionInfo()
+				return []interface{}{session, seq, end}, ok
+			},
+			val: []interface{}{0x2A, 3, true},
+		},
+	} {
+		t.Run(tagNames[tc.tag], func(t *testing.T) {
+			b, err := tc.set(NewOptions()).MarshalBinary()
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if !bytes.Equal(b, tc.exp) {
+				t.Errorf("MarshalBinary() => %X expected %X", b, tc.exp)
+			}
+			opts := NewOptions()
+			if err := opts.UnmarshalBinary(b); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if val, ok := tc.get(opts); !ok || !reflect.DeepEqual(val, tc.val) {
+				t.Errorf("getter => %v %t expected %v", val, ok, tc.val)
+			}
+			if _, ok := tc.get(NewOptions()); ok {
+				t.Errorf("getter on empty options should not be ok")
+			}
+		})
+	}
+}
+
+func TestOptionsGetAll(t *testing.T) {
+	body := []byte{
+		0x00, 0x1E, 0x00, 0x03, 'i', 'd', 0x00,
+		0x00, 0x1E, 0x00, 0x04, 'i', 'd', '2', 0x00,
+	}
+	opts := NewOptions()
+	if err := opts.UnmarshalBinary(body); err != nil {
+		t.Fatal(err)
+	}
+	all := opts.GetAll(TagReceiptedMessageID)
+	if len(all) != 2 || string(all[0]) != "id\x00" || string(all[1]) != "id2\x00" {
+		t.Errorf("GetAll() => %q expected both occurrences", all)
+	}
+	if id := opts.ReceiptedMessageID(); id != "id" {
+		t.Errorf("ReceiptedMessageID() => %q expected first occurrence", id)
+	}
+	b, err := opts.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, body) {
+		t.Errorf("MarshalBinary() => %X expected %X", b, body)
+	}
+	opts.SetReceiptedMessageID("id3")
+	if all := opts.GetAll(TagReceiptedMessageID); len(all) != 1 {
+		t.Errorf("setting option should replace all occurrences, got %q", all)
+	}
+	if all := NewOptions().GetAll(TagReceiptedMessageID); all != nil {
+		t.Errorf("GetAll() => %q expected nil", all)
+	}
+}
+
+func TestDescribeOptions(t *testing.T) {
+	sm := &SubmitSm{
+		DestinationAddr: "38160123456",
+		Options: NewOptions().
+			SetMessagePayload("hello").
+			SetUserMessageReference(0x0102).
+			SetReceiptedMessageID("id0").
+			SetSourceSubaddress(SubaddressUser, []byte{0xAB}).
+			Set(TagID(0x1400), []byte{0x01}),
+	}
+	b, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &SubmitSm{}
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	got := DescribeOptions(decoded.Options)
+	expected := []OptionDesc{
+		{TagReceiptedMessageID, "receipted_message_id", []byte("id0\x00"), "id0"},
+		{TagSourceSubaddress, "source_subaddress", []byte{SubaddressUser, 0xAB}, nil},
+		{TagUserMessageReference, "user_message_reference", []byte{0x01, 0x02}, 0x0102},
+		{TagMessagePayload, "message_payload", []byte("hello"), "hello"},
+		{TagID(0x1400), "0x1400", []byte{0x01}, nil},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("DescribeOptions() => %+v expected %+v", got, expected)
+	}
+	if DescribeOptions(nil) != nil {
+		t.Errorf("DescribeOptions(nil) should be nil")
+	}
+}
+
+func TestOptionsZeroLength(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body []byte
+	}{
+		{"end", []byte{0x02, 0x0D, 0x00, 0x01, 0x01, 0x13, 0x0C, 0x00, 0x00}},
+		{"middle", []byte{0x13, 0x0C, 0x00, 0x00, 0x02, 0x0D, 0x00, 0x01, 0x01}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := NewOptions()
+			if err := opts.UnmarshalBinary(tc.body); err != nil {
+				t.Fatal(err)
+			}
+			val, ok := opts.Get(TagAlertOnMessageDeliv)
+			if !ok || val == nil || len(val) != 0 {
+				t.Errorf("Get() => %v %t expected empty value", val, ok)
+			}
+			if _, ok := opts.GetSingle(TagAlertOnMessageDeliv); ok {
+				t.Errorf("GetSingle() on empty value should not be ok")
+			}
+			if _, ok := opts.GetDouble(TagAlertOnMessageDeliv); ok {
+				t.Errorf("GetDouble() on empty value should not be ok")
+			}
+			if _, ok := opts.GetCString(TagAlertOnMessageDeliv); ok {
+				t.Errorf("GetCString() on empty value should not be ok")
+			}
+			if lang, ok := opts.LanguageIndicator(); !ok || lang != LanguageEnglish {
+				t.Errorf("LanguageIndicator() => %d %t expected %d", lang, ok, LanguageEnglish)
+			}
+			b, err := opts.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := NewOptions()
+			if err := decoded.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, opts) {
+				t.Errorf("round trip => %+v expected %+v", decoded, opts)
+			}
+		})
+	}
+}
@@ -1,14 +1,20 @@
 package pdu
 
 import (
+	"bufio"
 	"bytes"
 	"encoding"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
+	"github.com/ajankovic/smpp/encoding/ascii"
+	"github.com/ajankovic/smpp/encoding/gsm7"
+	"github.com/ajankovic/smpp/encoding/latin1"
+	"github.com/ajankovic/smpp/encoding/ucs2"
 	smpptime "github.com/ajankovic/smpp/time"
 )
 
@@ -35,6 +41,29 @@ func (ec EsmClass) Byte() byte {
 	return out
 }
 
+// Validate checks that EsmClass can be encoded into a single byte and that
+// mode and type combination is allowed by the specification. Delivery receipts,
+// conversation aborts and intermediate notifications are sent by SMSC where
+// messaging mode is not applicable, so they can't be combined with other modes.
+func (ec EsmClass) Validate() error {
+	if ec.Mode < DefaultEsmMode || ec.Mode > StoreAndForwardEsmMode {
+		return fmt.Errorf("smpp/pdu: invalid esm_class mode %d", ec.Mode)
+	}
+	switch ec.Type {
+	case DefaultEsmType, DelAckEsmType, UsrAckEsmType:
+	case DelRecEsmType, ConAbtEsmType, IDNEsmType:
+		if ec.Mode != DefaultEsmMode {
+			return fmt.Errorf("smpp/pdu: esm_class type %d can't be combined with mode %d", ec.Type, ec.Mode)
+		}
+	default:
+		return fmt.Errorf("smpp/pdu: invalid esm_class type %d", ec.Type)
+	}
+	if ec.Feature < NoEsmFeat || ec.Feature > UDHIRepPathEsmFeat {
+		return fmt.Errorf("smpp/pdu: invalid esm_class feature %d", ec.Feature)
+	}
+	return nil
+}
+
 // ParseEsmClass parses esm class from pdu.
 func ParseEsmClass(b byte) EsmClass {
 	out := EsmClass{}
@@ -112,6 +141,21 @@ const (
 	YesInterNotification = 0x1
 )
 
+// writeRawTime writes already formatted SMPP time if raw is set, otherwise
+// it formats t using the layout.
+func writeRawTime(raw string, layout smpptime.Layout, t time.Time) ([]byte, error) {
+	if raw == "" {
+		return writeTime(layout, t)
+	}
+	if len(raw) != 16 {
+		return nil, fmt.Errorf("smpp/pdu: invalid time length %q", raw)
+	}
+	if _, err := smpptime.Parse([]byte(raw)); err != nil {
+		return nil, err
+	}
+	return append([]byte(raw), 0), nil
+}
+
 func writeTime(layout smpptime.Layout, t time.Time) ([]byte, error) {
 	var schedDel []byte
 	if !t.IsZero() {
@@ -126,6 +170,8 @@ func writeTime(layout smpptime.Layout, t time.Time) ([]byte, error) {
 
 type pduReader struct {
 	*bytes.Buffer
+	// lenient ignores length limits of C-Octet strings.
+	lenient bool
 }
 
 func newBuffer(buf []byte) *pduReader {
@@ -146,7 +192,7 @@ func (r *pduReader) ReadCString(limit int) ([]byte, error) {
 		if b == 0x0 {
 			return out, nil
 		}
-		if i == limit {
+		if i == limit && !r.lenient {
 			return nil, errors.New("invalid c string length")
 		}
 		out = append(out, b)
@@ -232,24 +278,36 @@ func (seq *defaultSequencer) Next() uint32 {
 
 // Encoder is responsible for encoding PDU structure to writer.
 type Encoder struct {
-	w   io.Writer
-	seq Sequencer
+	w       io.Writer
+	seq     Sequencer
+	maxSize int
 }
 
-// NewEncoder instantiates pdu encoder.
+// NewEncoder instantiates pdu encoder. Encoded PDUs are limited to
+// MaxPDUSize bytes, use SetMaxSize to change the limit.
 func NewEncoder(w io.Writer, seq Sequencer) *Encoder {
 	if seq == nil {
 		seq = NewSequencer(1)
 	}
 	return &Encoder{
-		w:   w,
-		seq: seq,
+		w:       w,
+		seq:     seq,
+		maxSize: MaxPDUSize,
 	}
 }
 
+// SetMaxSize sets maximal length of PDUs encoded by the encoder. Zero
+// means no limit.
+func (en *Encoder) SetMaxSize(n int) {
+	en.maxSize = n
+}
+
 type encoderOpts struct {
-	seq    uint32
-	status Status
+	seq           uint32
+	status        Status
+	maxSize       int
+	maxSizeSet    bool
+	allowEmptyDst bool
 }
 
 // Encode PDU structure and write it to the assigned writer.
@@ -257,28 +315,69 @@ func (en *Encoder) Encode(p PDU, opts ...EncoderOption) (uint32, error) {
 	// TODO consider introducing convention where pdu.MarshalBinary
 	// should return slice with prepended space for header to avoid
 	// allocation and copy.
-	body, err := p.MarshalBinary()
+	eOpts := encoderOpts{}
+	for _, o := range opts {
+		o(&eOpts)
+	}
+	body, err := marshalBody(p, eOpts)
 	if err != nil {
 		return 0, err
 	}
+	if !eOpts.maxSizeSet {
+		eOpts.maxSize = en.maxSize
+	}
 
-	eOpts := encoderOpts{}
-	for _, o := range opts {
-		o(&eOpts)
+	if err := checkSize(p.CommandID(), body, eOpts.maxSize); err != nil {
+		return 0, err
+	}
+	if eOpts.seq == 0 {
+		eOpts.seq = en.seq.Next()
+	}
+	_, err = en.w.Write(frame(p.CommandID(), eOpts.status, eOpts.seq, body))
+	return eOpts.seq, err
+}
+
+// marshalBody marshals PDU body honoring encoder options which affect it.
+func marshalBody(p PDU, eOpts encoderOpts) ([]byte, error) {
+	if sm, ok := p.(*SubmitSm); ok && eOpts.allowEmptyDst {
+		return sm.marshal(true)
+	}
+	return p.MarshalBinary()
+}
+
+// Marshal returns complete wire representation of the PDU, header included,
+// with provided sequence number and status. PDUs longer than MaxPDUSize
+// are rejected.
+func Marshal(p PDU, seq uint32, status Status) ([]byte, error) {
+	body, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSize(p.CommandID(), body, MaxPDUSize); err != nil {
+		return nil, err
 	}
+	return frame(p.CommandID(), status, seq, body), nil
+}
+
+// checkSize fails if PDU with the body would be longer than maxSize. Zero
+// maxSize means no limit.
+func checkSize(id CommandID, body []byte, maxSize int) error {
+	if l := len(body) + 16; maxSize > 0 && l > maxSize {
+		return fmt.Errorf("smpp/pdu: encoded %s length %d exceeds maximum pdu size %d", id, l, maxSize)
+	}
+	return nil
+}
 
+// frame prefixes body with the PDU header.
+func frame(id CommandID, status Status, seq uint32, body []byte) []byte {
 	l := len(body) + 16
 	buf := make([]byte, l)
 	binary.BigEndian.PutUint32(buf[:4], uint32(l))
-	binary.BigEndian.PutUint32(buf[4:8], uint32(p.CommandID()))
-	binary.BigEndian.PutUint32(buf[8:12], uint32(eOpts.status))
-	if eOpts.seq == 0 {
-		eOpts.seq = en.seq.Next()
-	}
-	binary.BigEndian.PutUint32(buf[12:16], eOpts.seq)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(id))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(status))
+	binary.BigEndian.PutUint32(buf[12:16], seq)
 	copy(buf[16:], body)
-	_, err = en.w.Write(buf)
-	return eOpts.seq, err
+	return buf
 }
 
 type EncoderOption func(*encoderOpts)
@@ -295,55 +394,265 @@ func EncodeStatus(status Status) EncoderOption {
 	}
 }
 
+// EncodeMaxSize makes Encode fail without writing anything if the encoded
+// PDU would be longer than n bytes. It overrides the limit of the encoder
+// for single call. Zero means no limit.
+func EncodeMaxSize(n int) EncoderOption {
+	return func(eOpts *encoderOpts) {
+		eOpts.maxSize = n
+		eOpts.maxSizeSet = true
+	}
+}
+
+// EncodeAllowEmptyDestination permits encoding submit_sm without
+// destination_addr for SMSCs that resolve the destination themselves.
+func EncodeAllowEmptyDestination() EncoderOption {
+	return func(eOpts *encoderOpts) {
+		eOpts.allowEmptyDst = true
+	}
+}
+
+// WriteHeaderAndBody writes already encoded PDU body prefixed with the header
+// to the assigned writer. Length from the header is ignored and calculated
+// from the body, which allows relaying raw PDUs with rewritten sequence.
+// Nothing is written if the frame would exceed the limit of the encoder.
+func (en *Encoder) WriteHeaderAndBody(h Header, body []byte) error {
+	if err := checkSize(h.CommandID(), body, en.maxSize); err != nil {
+		return err
+	}
+	_, err := en.w.Write(frame(h.CommandID(), h.Status(), h.Sequence(), body))
+	return err
+}
+
+// DefaultDecodeBufferSize is the size of the read buffer used by Decoder.
+const DefaultDecodeBufferSize = 4096
+
 // Decoder reads input from reader and marshals it into PDU.
 type Decoder struct {
-	r io.Reader
+	r       io.Reader
+	maxSize int
+	pool    *BufferPool
+	lenient bool
+}
+
+type decoderOpts struct {
+	bufSize int
+	maxSize int
+	pool    *BufferPool
+	lenient bool
+}
+
+// DecoderOption configures Decoder.
+type DecoderOption func(*decoderOpts)
+
+// DecodeBufferSize sets size of the buffer used for reading from the
+// underlying reader. Size zero or less disables buffering.
+func DecodeBufferSize(n int) DecoderOption {
+	return func(dOpts *decoderOpts) {
+		dOpts.bufSize = n
+	}
+}
+
+// DecodeMaxSize sets maximal accepted PDU length. PDUs declaring larger
+// command_length are rejected before their body is read. Defaults to MaxPDUSize.
+func DecodeMaxSize(n int) DecoderOption {
+	return func(dOpts *decoderOpts) {
+		dOpts.maxSize = n
+	}
+}
+
+// DecodePool makes Decode read PDUs into buffers taken from the pool instead
+// of allocating new ones. Pool can be shared between decoders used
+// concurrently. DecodeRaw doesn't use the pool since it returns the body.
+func DecodePool(bp *BufferPool) DecoderOption {
+	return func(dOpts *decoderOpts) {
+		dOpts.pool = bp
+	}
+}
+
+// DecodeLenient makes Decode tolerate C-Octet strings longer than allowed by
+// the specification, like service_type over 5 characters, which are sent by
+// non-conformant peers. It applies to submit_sm and deliver_sm.
+func DecodeLenient() DecoderOption {
+	return func(dOpts *decoderOpts) {
+		dOpts.lenient = true
+	}
+}
+
+// lenientUnmarshaler is implemented by PDUs supporting lenient decoding.
+type lenientUnmarshaler interface {
+	unmarshalLenient(body []byte) error
 }
 
-// NewDecoder initializes new PDU decoder.
-func NewDecoder(r io.Reader) *Decoder {
+// NewDecoder initializes new PDU decoder. Reads from r are buffered
+// so multiple PDUs can be decoded from single read.
+func NewDecoder(r io.Reader, opts ...DecoderOption) *Decoder {
+	dOpts := decoderOpts{
+		bufSize: DefaultDecodeBufferSize,
+		maxSize: MaxPDUSize,
+	}
+	for _, o := range opts {
+		o(&dOpts)
+	}
+	if dOpts.bufSize > 0 {
+		r = bufio.NewReaderSize(r, dOpts.bufSize)
+	}
 	return &Decoder{
-		r: r,
+		r:       r,
+		maxSize: dOpts.maxSize,
+		pool:    dOpts.pool,
+		lenient: dOpts.lenient,
 	}
 }
 
 // Decode reads data from reader and populates PDU.
+//
+// If PDU body can't be unmarshaled header and partially populated PDU are
+// returned together with the DecodeError of ErrBodyDecode kind. Unsupported
+// command_id results in the same error kind wrapping ErrUnknownCommand with
+// nil PDU. Invalid command_length results in DecodeError of ErrFraming kind
+// and failed reads in TransportError. io.EOF is returned as is if reader is
+// exhausted at the PDU boundary.
 func (d *Decoder) Decode() (Header, PDU, error) {
-	// Read header first.
-	h := make([]byte, 16)
-	n, err := d.r.Read(h)
+	var h Header
+	var body []byte
+	var err error
+	if d.pool != nil {
+		buf := d.pool.get()
+		defer d.pool.put(buf)
+		h, body, err = d.decodeRaw((*buf)[:16], (*buf)[16:])
+	} else {
+		h, body, err = d.DecodeRaw()
+	}
 	if err != nil {
-		return nil, nil, err
+		if h == nil {
+			return nil, nil, err
+		}
+		return h, nil, err
+	}
+	p := newPDU(h.CommandID())
+	if p == nil {
+		err := fmt.Errorf("%w %s", ErrUnknownCommand, h.CommandID())
+		return h, nil, &DecodeError{Kind: ErrBodyDecode, Err: err}
+	}
+	if len(body) == 0 {
+		return h, p, nil
+	}
+	if lu, ok := p.(lenientUnmarshaler); ok && d.lenient {
+		err = lu.unmarshalLenient(body)
+	} else if gn, ok := p.(*GenericNack); ok {
+		err = gn.unmarshalEcho(body)
+	} else {
+		err = p.UnmarshalBinary(body)
 	}
-	if n != 16 {
-		return nil, nil, errors.New("smpp: invalid pdu header byte length")
+	if err != nil {
+		return h, p, &DecodeError{Kind: ErrBodyDecode, Err: err}
+	}
+	return h, p, nil
+}
+
+// DecodeRaw reads data from reader and returns PDU header and body bytes
+// without unmarshaling the body. It's useful for relaying PDUs without
+// paying the cost of decoding them.
+func (d *Decoder) DecodeRaw() (Header, []byte, error) {
+	return d.decodeRaw(make([]byte, 16), nil)
+}
+
+// decodeRaw reads header into hb and body into buf if it has enough
+// capacity, otherwise body is read into newly allocated slice.
+func (d *Decoder) decodeRaw(hb, buf []byte) (Header, []byte, error) {
+	// Read header first.
+	if _, err := io.ReadFull(d.r, hb); err != nil {
+		if err == io.EOF {
+			return nil, nil, err
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("smpp: invalid pdu header byte length: %w", err)
+		}
+		return nil, nil, &TransportError{Err: err}
 	}
 	he := &header{}
-	if err := he.UnmarshalBinary(h); err != nil {
-		return nil, nil, err
+	if err := he.UnmarshalBinary(hb); err != nil {
+		return nil, nil, &DecodeError{Kind: ErrFraming, Err: err}
+	}
+	if d.maxSize > 0 && int64(he.length) > int64(d.maxSize) {
+		err := fmt.Errorf("smpp: pdu length %d over upper limit %d", he.length, d.maxSize)
+		return nil, nil, &DecodeError{Kind: ErrFraming, Err: err}
 	}
-	p := NewPDU(he.commandID)
 	if he.length == 16 {
-		return he, p, nil
+		return he, nil, nil
+	}
+
+	// Read rest of the PDU. Large bodies are read into growing buffer so
+	// the declared length alone can't force large allocation.
+	l := int64(he.length - 16)
+	if l > int64(cap(buf)) && l > DefaultDecodeBufferSize {
+		var bb bytes.Buffer
+		bb.Grow(DefaultDecodeBufferSize)
+		n, err := io.CopyN(&bb, d.r, l)
+		if err == io.EOF {
+			err = fmt.Errorf("smpp: pdu length doesn't match read body length %d != %d: %w", he.length, n+16, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return he, nil, &TransportError{Err: err}
+		}
+		return he, bb.Bytes(), nil
+	}
+	if l <= int64(cap(buf)) {
+		buf = buf[:l]
+	} else {
+		buf = make([]byte, l)
+	}
+	n, err := io.ReadFull(d.r, buf)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = fmt.Errorf("smpp: pdu length doesn't match read body length %d != %d: %w", he.length, n+16, io.ErrUnexpectedEOF)
 	}
-
-	// Read rest of the PDU.
-	buf := make([]byte, he.length-16)
-	n, err = d.r.Read(buf)
 	if err != nil {
-		return he, nil, err
+		return he, nil, &TransportError{Err: err}
 	}
-	if n != int(he.length-16) {
-		return he, nil, fmt.Errorf("smpp: pdu length doesn't match read body length %d != %d", he.length, n)
+	return he, buf, nil
+}
+
+// BufferPool holds buffers shared between decoders. Buffers are only used
+// during Decode and decoded PDUs never reference them.
+type BufferPool struct {
+	pool sync.Pool
+}
+
+// NewBufferPool creates pool of buffers capable of holding PDUs of up to
+// size bytes. Larger PDUs are decoded into newly allocated buffers.
+func NewBufferPool(size int) *BufferPool {
+	if size < 16 {
+		size = 16
 	}
-	if err := p.UnmarshalBinary(buf); err != nil {
-		return he, nil, err
+	bp := &BufferPool{}
+	bp.pool.New = func() interface{} {
+		b := make([]byte, size)
+		return &b
 	}
-	return he, p, nil
+	return bp
+}
+
+func (bp *BufferPool) get() *[]byte {
+	return bp.pool.Get().(*[]byte)
+}
+
+func (bp *BufferPool) put(b *[]byte) {
+	bp.pool.Put(b)
 }
 
-// NewPDU creates new PDU from CommandID.
+// NewPDU creates new PDU from CommandID. It panics if command is not
+// supported.
 func NewPDU(commandID CommandID) PDU {
+	if p := newPDU(commandID); p != nil {
+		return p
+	}
+	panic("pdu: unsupported PDU command")
+}
+
+// newPDU creates new PDU from CommandID or returns nil if command is not
+// supported.
+func newPDU(commandID CommandID) PDU {
 	switch commandID {
 	case GenericNackID:
 		return &GenericNack{}
@@ -400,7 +709,7 @@ func NewPDU(commandID CommandID) PDU {
 	case DataSmRespID:
 		return &DataSmResp{}
 	}
-	panic("pdu: unsupported PDU command")
+	return nil
 }
 
 // IsRequest returns true if command is request.
@@ -425,6 +734,48 @@ func IsRequest(id CommandID) bool {
 	}
 }
 
+// IsResponse returns true if command is response.
+func IsResponse(id CommandID) bool {
+	return !IsRequest(id)
+}
+
+var responseIDs = map[CommandID]CommandID{
+	BindReceiverID:    BindReceiverRespID,
+	BindTransmitterID: BindTransmitterRespID,
+	QuerySmID:         QuerySmRespID,
+	SubmitSmID:        SubmitSmRespID,
+	DeliverSmID:       DeliverSmRespID,
+	UnbindID:          UnbindRespID,
+	ReplaceSmID:       ReplaceSmRespID,
+	CancelSmID:        CancelSmRespID,
+	BindTransceiverID: BindTransceiverRespID,
+	EnquireLinkID:     EnquireLinkRespID,
+	SubmitMultiID:     SubmitMultiRespID,
+	DataSmID:          DataSmRespID,
+}
+
+var requestIDs = func() map[CommandID]CommandID {
+	out := make(map[CommandID]CommandID, len(responseIDs))
+	for req, resp := range responseIDs {
+		out[resp] = req
+	}
+	return out
+}()
+
+// ResponseID returns command id of the response for the request command id.
+// It returns false if request has no response like outbind and alert_notification.
+func ResponseID(reqID CommandID) (CommandID, bool) {
+	id, ok := responseIDs[reqID]
+	return id, ok
+}
+
+// RequestID returns command id of the request for the response command id.
+// It returns false if response has no request counterpart like generic_nack.
+func RequestID(respID CommandID) (CommandID, bool) {
+	id, ok := requestIDs[respID]
+	return id, ok
+}
+
 // SystemID extracts system id value from PDU if it has one.
 func SystemID(p PDU) string {
 	switch p.CommandID() {
@@ -456,6 +807,69 @@ func SystemID(p PDU) string {
 	return ""
 }
 
+// PeekSubmitAddresses extracts source_addr and destination_addr from raw
+// submit_sm or deliver_sm body without unmarshaling the rest of the PDU.
+// It's useful for routing decisions before full decoding.
+func PeekSubmitAddresses(body []byte) (string, string, error) {
+	// Skip service_type.
+	n, err := skipCString(body, 0, 6)
+	if err != nil {
+		return "", "", fmt.Errorf("smpp/pdu: peeking service_type %s", err)
+	}
+	// Skip source_addr_ton and source_addr_npi.
+	src, n, err := peekCString(body, n+2, 21)
+	if err != nil {
+		return "", "", fmt.Errorf("smpp/pdu: peeking source_addr %s", err)
+	}
+	// Skip dest_addr_ton and dest_addr_npi.
+	dst, _, err := peekCString(body, n+2, 21)
+	if err != nil {
+		return "", "", fmt.Errorf("smpp/pdu: peeking destination_addr %s", err)
+	}
+	return src, dst, nil
+}
+
+// skipCString returns offset after the c string starting at offset i
+// which can have up to limit bytes including the terminator.
+func skipCString(body []byte, i, limit int) (int, error) {
+	if i > len(body) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	end := len(body)
+	if i+limit < end {
+		end = i + limit
+	}
+	n := bytes.IndexByte(body[i:end], 0)
+	if n < 0 {
+		if end == len(body) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, errors.New("invalid c string length")
+	}
+	return i + n + 1, nil
+}
+
+func peekCString(body []byte, i, limit int) (string, int, error) {
+	n, err := skipCString(body, i, limit)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(body[i : n-1]), n, nil
+}
+
+// SystemType extracts system type value from bind PDU.
+func SystemType(p PDU) string {
+	switch p := p.(type) {
+	case *BindRx:
+		return p.SystemType
+	case *BindTx:
+		return p.SystemType
+	case *BindTRx:
+		return p.SystemType
+	}
+	return ""
+}
+
 // SeparateUDH takes input bytes and separates them into UDH header and content.
 func SeparateUDH(c []byte) ([]byte, []byte, error) {
 	if len(c) == 0 {
@@ -467,3 +881,25 @@ func SeparateUDH(c []byte) ([]byte, []byte, error) {
 	}
 	return c[:l+1], c[l+1:], nil
 }
+
+// encodeText encodes text using provided data coding and returns data coding
+// that was actually used.
+func encodeText(coding int, text string) (int, []byte, error) {
+	switch coding {
+	case DataCodingDefault:
+		if !gsm7.Valid(text) {
+			return DataCodingUCS2, ucs2.Encode(text), nil
+		}
+		b, err := gsm7.Encode(text)
+		return coding, b, err
+	case DataCodingIA5:
+		b, err := ascii.Encode(text)
+		return coding, b, err
+	case DataCodingLatin1:
+		b, err := latin1.Encode(text)
+		return coding, b, err
+	case DataCodingUCS2:
+		return coding, ucs2.Encode(text), nil
+	}
+	return coding, nil, fmt.Errorf("smpp/pdu: unsupported data_coding for text 0x%02X", coding)
+}
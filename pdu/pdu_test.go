@@ -3,9 +3,14 @@ package pdu
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 var pduTT = []struct {
@@ -95,6 +100,21 @@ var pduTT = []struct {
 		},
 		false,
 	},
+	{
+		"generic_nack without body",
+		"",
+		&GenericNack{},
+		false,
+	},
+	{
+		"valid outbind pdu",
+		"534d534300|73656372657400",
+		&Outbind{
+			SystemID: "SMSC",
+			Password: "secret",
+		},
+		false,
+	},
 	// Always append new cases to avoid messing up Encoding/Decoding tests which
 	// rely on indexes in this table.
 }
@@ -300,3 +320,459 @@ func TestPDUDecoding(t *testing.T) {
 		})
 	}
 }
+
+func TestPDURawRelay(t *testing.T) {
+	in, _ := hex.DecodeString(toHexStr(codingTT[0].headerHex + pduTT[0].hexStr))
+	dec := NewDecoder(bytes.NewBuffer(in))
+	h, body, err := dec.DecodeRaw()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if h.CommandID() != SubmitSmID {
+		t.Errorf("DecodeRaw() => command %s expected %s", h.CommandID(), SubmitSmID)
+	}
+	out := bytes.NewBuffer(nil)
+	enc := NewEncoder(out, nil)
+	if err := enc.WriteHeaderAndBody(NewHeader(h.CommandID(), h.Status(), 3), body); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected, _ := hex.DecodeString(toHexStr(codingTT[1].headerHex + pduTT[0].hexStr))
+	if !bytes.Equal(expected, out.Bytes()) {
+		t.Errorf("WriteHeaderAndBody() => bytes\n%X\nexpected \n%X", out.Bytes(), expected)
+	}
+}
+
+func encodeFrame(tb testing.TB, p PDU) []byte {
+	buf := bytes.NewBuffer(nil)
+	if _, err := NewEncoder(buf, nil).Encode(p); err != nil {
+		tb.Fatalf("error with encoding %v", err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkRelay_DecodeEncode(b *testing.B) {
+	in := encodeFrame(b, pduTT[1].pdu)
+	b.SetBytes(int64(len(in)))
+	r := bytes.NewReader(in)
+	enc := NewEncoder(ioutil.Discard, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(in)
+		h, p, err := NewDecoder(r).Decode()
+		if err != nil {
+			b.Fatalf("error with decoding %v", err)
+		}
+		if _, err := enc.Encode(p, EncodeSeq(h.Sequence()), EncodeStatus(h.Status())); err != nil {
+			b.Fatalf("error with encoding %v", err)
+		}
+	}
+}
+
+func BenchmarkRelay_Raw(b *testing.B) {
+	in := encodeFrame(b, pduTT[1].pdu)
+	b.SetBytes(int64(len(in)))
+	r := bytes.NewReader(in)
+	enc := NewEncoder(ioutil.Discard, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(in)
+		h, body, err := NewDecoder(r).DecodeRaw()
+		if err != nil {
+			b.Fatalf("error with decoding %v", err)
+		}
+		if err := enc.WriteHeaderAndBody(h, body); err != nil {
+			b.Fatalf("error with encoding %v", err)
+		}
+	}
+}
+
+func TestRequestResponseIDs(t *testing.T) {
+	if !IsRequest(SubmitSmID) || IsResponse(SubmitSmID) {
+		t.Errorf("submit_sm should be request")
+	}
+	if !IsResponse(SubmitSmRespID) || IsRequest(SubmitSmRespID) {
+		t.Errorf("submit_sm_resp should be response")
+	}
+	if id, ok := ResponseID(SubmitSmID); !ok || id != SubmitSmRespID {
+		t.Errorf("ResponseID(SubmitSmID) => %s %t expected %s", id, ok, SubmitSmRespID)
+	}
+	if id, ok := RequestID(SubmitSmRespID); !ok || id != SubmitSmID {
+		t.Errorf("RequestID(SubmitSmRespID) => %s %t expected %s", id, ok, SubmitSmID)
+	}
+	if _, ok := RequestID(GenericNackID); ok {
+		t.Errorf("RequestID(GenericNackID) should have no request counterpart")
+	}
+	for _, id := range []CommandID{OutbindID, AlertNotificationID} {
+		if _, ok := ResponseID(id); ok {
+			t.Errorf("ResponseID(%s) should have no response counterpart", id)
+		}
+	}
+}
+
+func TestDecoderBufferBoundaries(t *testing.T) {
+	var in []byte
+	for i := 0; i < 5; i++ {
+		in = append(in, encodeFrame(t, pduTT[1].pdu)...)
+	}
+	for _, size := range []int{0, 16, 20, 4096} {
+		dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(in)), DecodeBufferSize(size))
+		for i := 0; i < 5; i++ {
+			_, p, err := dec.Decode()
+			if err != nil {
+				t.Fatalf("buffer %d pdu %d: unexpected error %v", size, i, err)
+			}
+			if !reflect.DeepEqual(p, pduTT[1].pdu) {
+				t.Errorf("buffer %d pdu %d: Decode() => %+v expected %+v", size, i, p, pduTT[1].pdu)
+			}
+		}
+		if _, _, err := dec.Decode(); err != io.EOF {
+			t.Errorf("buffer %d: expected EOF got %v", size, err)
+		}
+	}
+}
+
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	cr.reads++
+	return cr.r.Read(p)
+}
+
+func benchmarkDecoder(b *testing.B, opts ...DecoderOption) {
+	const n = 10000
+	frame := encodeFrame(b, &DeliverSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "hi",
+	})
+	in := bytes.Repeat(frame, n)
+	b.SetBytes(int64(len(in)))
+	r := bytes.NewReader(in)
+	reads := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(in)
+		cr := &countingReader{r: r}
+		dec := NewDecoder(cr, opts...)
+		for j := 0; j < n; j++ {
+			if _, _, err := dec.Decode(); err != nil {
+				b.Fatalf("error with decoding %v", err)
+			}
+		}
+		reads += cr.reads
+	}
+	b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+}
+
+func BenchmarkDecoder_Unbuffered(b *testing.B) {
+	benchmarkDecoder(b, DecodeBufferSize(0))
+}
+
+func BenchmarkDecoder_Buffered(b *testing.B) {
+	benchmarkDecoder(b)
+}
+
+func benchmarkDecoderSessions(b *testing.B, opts ...DecoderOption) {
+	const n = 100
+	frame := encodeFrame(b, &EnquireLink{})
+	in := bytes.Repeat(frame, n)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := bytes.NewReader(in)
+		for pb.Next() {
+			r.Reset(in)
+			dec := NewDecoder(r, append([]DecoderOption{DecodeBufferSize(0)}, opts...)...)
+			for j := 0; j < n; j++ {
+				if _, _, err := dec.Decode(); err != nil {
+					b.Fatalf("error with decoding %v", err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkDecoderSessions_Alloc(b *testing.B) {
+	benchmarkDecoderSessions(b)
+}
+
+func BenchmarkDecoderSessions_Pool(b *testing.B) {
+	benchmarkDecoderSessions(b, DecodePool(NewBufferPool(MaxPDUSize)))
+}
+
+func TestDecoderPool(t *testing.T) {
+	p := &SubmitSm{
+		SourceAddr:      "111",
+		DestinationAddr: "222",
+		ShortMessage:    "first",
+		Options:         NewOptions().SetMessagePayload("payload"),
+	}
+	in := encodeFrame(t, p)
+	second := *p
+	second.ShortMessage = "other"
+	second.Options = NewOptions().SetMessagePayload("changed")
+	in = append(in, encodeFrame(t, &second)...)
+	dec := NewDecoder(bytes.NewReader(in), DecodePool(NewBufferPool(MaxPDUSize)))
+	_, first, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	sm := first.(*SubmitSm)
+	if sm.ShortMessage != "first" || sm.Options.MessagePayload() != "payload" {
+		t.Errorf("decoded pdu references reused buffer %+v", sm)
+	}
+}
+
+func TestEsmClassValidate(t *testing.T) {
+	tt := []struct {
+		name string
+		ec   EsmClass
+		err  bool
+	}{
+		{"default", EsmClass{}, false},
+		{"delivery receipt", EsmClass{Mode: DefaultEsmMode, Type: DelRecEsmType}, false},
+		{"store and forward with udhi", EsmClass{Mode: StoreAndForwardEsmMode, Feature: UDHIEsmFeat}, false},
+		{"datagram user ack", EsmClass{Mode: DatagramEsmMode, Type: UsrAckEsmType}, false},
+		{"store and forward delivery receipt", EsmClass{Mode: StoreAndForwardEsmMode, Type: DelRecEsmType}, true},
+		{"not applicable mode", EsmClass{Mode: NotApplicableEsmMode}, true},
+		{"reserved type", EsmClass{Type: 0x3}, true},
+	}
+	for _, tc := range tt {
+		err := tc.ec.Validate()
+		if tc.err && err == nil {
+			t.Errorf("%s: expected error got nil", tc.name)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error %s", tc.name, err)
+		}
+	}
+	p := SubmitSm{EsmClass: EsmClass{Mode: StoreAndForwardEsmMode, Type: DelRecEsmType}}
+	if _, err := p.MarshalBinary(); err == nil {
+		t.Errorf("expected submit_sm marshal error for invalid esm_class")
+	}
+}
+
+func TestDecoderMaxSize(t *testing.T) {
+	frame := make([]byte, 16+64)
+	frame[3] = 16 + 64 + 1
+	frame[7] = byte(EnquireLinkID)
+	cr := &countingReader{r: bytes.NewReader(frame)}
+	dec := NewDecoder(cr, DecodeBufferSize(0), DecodeMaxSize(16+64))
+	if _, _, err := dec.Decode(); err == nil {
+		t.Fatal("expected error for pdu over the limit")
+	}
+	if cr.reads != 1 {
+		t.Errorf("expected only header to be read got %d reads", cr.reads)
+	}
+
+	// Declared length within the limit but stream is truncated.
+	const declared = 1 << 20
+	header := []byte{0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0, 0, 0, 0, 0, 0, 0, 1}
+	dec = NewDecoder(bytes.NewReader(append(header, 1, 2, 3)), DecodeMaxSize(declared))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := dec.Decode()
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Fatal("expected error for truncated pdu")
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > declared/4 {
+		t.Errorf("decoding truncated pdu allocated %d bytes", alloc)
+	}
+}
+
+func TestEncoderMaxSize(t *testing.T) {
+	sm := &SubmitSm{DestinationAddr: "38160123456"}
+	body, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fill message_payload so the frame is exactly one byte over the limit.
+	payload := strings.Repeat("a", MaxPDUSize-16-len(body)-4+1)
+	sm.Options = NewOptions().SetMessagePayload(payload)
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, nil)
+	_, err = enc.Encode(sm)
+	if err == nil || !strings.Contains(err.Error(), "length 4097 exceeds maximum pdu size 4096") {
+		t.Errorf("expected max size error got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written got %d bytes", buf.Len())
+	}
+	if _, err := enc.Encode(sm, EncodeMaxSize(MaxPDUSize+1)); err != nil {
+		t.Errorf("encoding with raised limit %v", err)
+	}
+	buf.Reset()
+	enc.SetMaxSize(0)
+	if _, err := enc.Encode(sm); err != nil {
+		t.Errorf("encoding without limit %v", err)
+	}
+	if buf.Len() != MaxPDUSize+1 {
+		t.Errorf("written %d bytes expected %d", buf.Len(), MaxPDUSize+1)
+	}
+	if _, err := Marshal(sm, 1, StatusOK); err == nil {
+		t.Errorf("expected max size error from Marshal")
+	}
+	body, err = sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	enc.SetMaxSize(MaxPDUSize)
+	if err := enc.WriteHeaderAndBody(NewHeader(SubmitSmID, StatusOK, 1), body); err == nil {
+		t.Errorf("expected max size error from WriteHeaderAndBody")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written got %d bytes", buf.Len())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	p := pduTT[1].pdu
+	buf := bytes.NewBuffer(nil)
+	enc := NewEncoder(buf, nil)
+	if _, err := enc.Encode(p, EncodeSeq(42), EncodeStatus(StatusThrottled)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Marshal(p, 42, StatusThrottled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, buf.Bytes()) {
+		t.Errorf("Marshal() => %X expected %X", out, buf.Bytes())
+	}
+}
+
+func TestDecoderErrorCategories(t *testing.T) {
+	tt := []struct {
+		name      string
+		in        []byte
+		kind      error
+		temporary bool
+	}{
+		{
+			name: "length under limit",
+			in:   []byte{0, 0, 0, 8, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1},
+			kind: ErrFraming,
+		},
+		{
+			name: "length over limit",
+			in:   []byte{0x7F, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1},
+			kind: ErrFraming,
+		},
+		{
+			name:      "malformed body",
+			in:        []byte{0, 0, 0, 17, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1, 0},
+			kind:      ErrBodyDecode,
+			temporary: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := NewDecoder(bytes.NewReader(tc.in)).Decode()
+			if !errors.Is(err, tc.kind) {
+				t.Fatalf("Decode() => %v expected %v", err, tc.kind)
+			}
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("expected DecodeError got %T", err)
+			}
+			if de.Temporary() != tc.temporary {
+				t.Errorf("Temporary() => %t expected %t", de.Temporary(), tc.temporary)
+			}
+		})
+	}
+	unknown := []byte{0, 0, 0, 17, 0, 0, 0x01, 0x99, 0, 0, 0, 0, 0, 0, 0, 1, 0}
+	h, p, err := NewDecoder(bytes.NewReader(unknown)).Decode()
+	if !errors.Is(err, ErrBodyDecode) || !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("unknown command: expected ErrBodyDecode with ErrUnknownCommand got %v", err)
+	}
+	if h == nil || h.Sequence() != 1 || p != nil {
+		t.Errorf("unknown command: expected header and nil pdu got %v %v", h, p)
+	}
+	for _, in := range [][]byte{
+		{0, 0, 0, 16, 0, 0},
+		{0, 0, 0, 32, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1, 0},
+	} {
+		_, _, err := NewDecoder(bytes.NewReader(in)).Decode()
+		var te *TransportError
+		if !errors.As(err, &te) {
+			t.Fatalf("mid-stream EOF: expected TransportError got %T %v", err, err)
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("mid-stream EOF: expected io.ErrUnexpectedEOF got %v", err)
+		}
+		if errors.Is(err, ErrFraming) || te.Temporary() {
+			t.Errorf("mid-stream EOF: unexpected error category %v", err)
+		}
+	}
+	if _, _, err := NewDecoder(bytes.NewReader(nil)).Decode(); err != io.EOF {
+		t.Errorf("expected EOF at pdu boundary got %v", err)
+	}
+}
+
+func TestGenericNackEcho(t *testing.T) {
+	// Value must keep implementing PDU.
+	var _ PDU = GenericNack{}
+	nack := &GenericNack{OriginalCommandID: SubmitSmID, OriginalSequence: 7}
+	body, err := nack.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0, 0, 0, 4, 0, 0, 0, 7}; !bytes.Equal(body, expected) {
+		t.Errorf("MarshalBinary() => %X expected %X", body, expected)
+	}
+	buf := bytes.NewBuffer(nil)
+	if _, err := NewEncoder(buf, nil).Encode(nack, EncodeSeq(7), EncodeStatus(StatusInvCmdID)); err != nil {
+		t.Fatal(err)
+	}
+	h, p, err := NewDecoder(buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.CommandID() != GenericNackID || h.Status() != StatusInvCmdID {
+		t.Errorf("Decode() header %s %s", h.CommandID(), h.Status())
+	}
+	if !reflect.DeepEqual(p, nack) {
+		t.Errorf("Decode() => %+v expected %+v", p, nack)
+	}
+}
+
+func TestPeekSubmitAddresses(t *testing.T) {
+	body, _ := hex.DecodeString(toHexStr(pduTT[0].hexStr))
+	src, dst, err := PeekSubmitAddresses(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := pduTT[0].pdu.(*SubmitSm)
+	if src != sm.SourceAddr || dst != sm.DestinationAddr {
+		t.Errorf("PeekSubmitAddresses() => %q %q expected %q %q", src, dst, sm.SourceAddr, sm.DestinationAddr)
+	}
+	body, _ = hex.DecodeString(toHexStr(pduTT[1].hexStr))
+	src, dst, err = PeekSubmitAddresses(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm = pduTT[1].pdu.(*SubmitSm)
+	if src != sm.SourceAddr || dst != sm.DestinationAddr {
+		t.Errorf("PeekSubmitAddresses() => %q %q expected %q %q", src, dst, sm.SourceAddr, sm.DestinationAddr)
+	}
+	for _, bad := range []string{"", "00|00|00|7465737400|00", "00|00|00|74657374"} {
+		b, _ := hex.DecodeString(toHexStr(bad))
+		if _, _, err := PeekSubmitAddresses(b); err == nil {
+			t.Errorf("PeekSubmitAddresses(%q) expected error", bad)
+		}
+	}
+	long, _ := hex.DecodeString(toHexStr("00|00|00|" + strings.Repeat("61", 30) + "00"))
+	if _, _, err := PeekSubmitAddresses(long); err == nil {
+		t.Errorf("PeekSubmitAddresses() expected error for too long source_addr")
+	}
+}
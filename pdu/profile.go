@@ -0,0 +1,78 @@
+package pdu
+
+import "fmt"
+
+// Profile defines network type whose rules are used for local validation
+// of PDU fields before sending.
+type Profile int
+
+const (
+	// ProfileNone disables profile validation.
+	ProfileNone Profile = iota
+	// ProfileGSM validates fields according to GSM network rules.
+	ProfileGSM
+	// ProfileTDMA validates fields according to ANSI-136 network rules.
+	ProfileTDMA
+	// ProfileCDMA validates fields according to IS-95 network rules.
+	ProfileCDMA
+)
+
+func (pr Profile) String() string {
+	switch pr {
+	case ProfileNone:
+		return "None"
+	case ProfileGSM:
+		return "GSM"
+	case ProfileTDMA:
+		return "ANSI-136"
+	case ProfileCDMA:
+		return "IS-95"
+	}
+	return fmt.Sprintf("Profile(%d)", int(pr))
+}
+
+// Validate checks priority_flag, data_coding and registered_delivery of
+// submit_sm and deliver_sm against the network rules. Other PDUs are
+// not validated.
+func (pr Profile) Validate(p PDU) error {
+	if pr == ProfileNone {
+		return nil
+	}
+	switch p := p.(type) {
+	case *SubmitSm:
+		return pr.validate(p.PriorityFlag, p.DataCoding, p.RegisteredDelivery)
+	case *DeliverSm:
+		return pr.validate(p.PriorityFlag, p.DataCoding, p.RegisteredDelivery)
+	}
+	return nil
+}
+
+func (pr Profile) validate(priority, coding int, rd RegisteredDelivery) error {
+	if priority < PriorityLevel0 || priority > PriorityLevel3 {
+		return fmt.Errorf("smpp/pdu: priority_flag %d is not valid for %s network", priority, pr)
+	}
+	if !pr.validDataCoding(coding) {
+		return fmt.Errorf("smpp/pdu: data_coding 0x%02X is not valid for %s network", coding, pr)
+	}
+	if rd.Receipt < NoDeliveryReceipt || rd.Receipt > FailDeliveryReceipt {
+		return fmt.Errorf("smpp/pdu: registered_delivery receipt %d is not valid for %s network", rd.Receipt, pr)
+	}
+	if rd.SMEAck < NoSMEAck || rd.SMEAck > AllSMEAck {
+		return fmt.Errorf("smpp/pdu: registered_delivery sme ack %d is not valid for %s network", rd.SMEAck, pr)
+	}
+	if rd.InterNotification < NoInterNotification || rd.InterNotification > YesInterNotification {
+		return fmt.Errorf("smpp/pdu: registered_delivery intermediate notification %d is not valid for %s network", rd.InterNotification, pr)
+	}
+	return nil
+}
+
+func (pr Profile) validDataCoding(coding int) bool {
+	switch {
+	case coding >= 0x00 && coding <= 0x0A, coding == 0x0D, coding == 0x0E:
+		return true
+	case coding >= 0xC0 && coding <= 0xFF:
+		// Message waiting indication and message class groups are GSM specific.
+		return pr == ProfileGSM
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package pdu
+
+import "testing"
+
+func TestProfileValidate(t *testing.T) {
+	tt := []struct {
+		desc    string
+		profile Profile
+		pdu     PDU
+		err     bool
+	}{
+		{"no profile", ProfileNone, &SubmitSm{PriorityFlag: 4}, false},
+		{"gsm valid priority", ProfileGSM, &SubmitSm{PriorityFlag: PriorityLevel3}, false},
+		{"gsm invalid priority", ProfileGSM, &SubmitSm{PriorityFlag: 4}, true},
+		{"gsm message class coding", ProfileGSM, &SubmitSm{DataCoding: 0xF1}, false},
+		{"cdma message class coding", ProfileCDMA, &SubmitSm{DataCoding: 0xF1}, true},
+		{"tdma reserved coding", ProfileTDMA, &DeliverSm{DataCoding: 0x20}, true},
+		{"gsm invalid receipt", ProfileGSM, &SubmitSm{RegisteredDelivery: RegisteredDelivery{Receipt: 3}}, true},
+		{"gsm other pdu", ProfileGSM, &EnquireLink{}, false},
+	}
+	for _, tc := range tt {
+		err := tc.profile.Validate(tc.pdu)
+		if tc.err && err == nil {
+			t.Errorf("%s: expected error got nil", tc.desc)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error %s", tc.desc, err)
+		}
+	}
+}
@@ -67,6 +67,39 @@ func (p *QuerySm) UnmarshalBinary(body []byte) error {
 	return nil
 }
 
+// MessageState defines state of the short message in the SMSC.
+type MessageState int
+
+// Message states defined by the specification.
+const (
+	MessageStateEnRoute       MessageState = 1
+	MessageStateDelivered     MessageState = 2
+	MessageStateExpired       MessageState = 3
+	MessageStateDeleted       MessageState = 4
+	MessageStateUndeliverable MessageState = 5
+	MessageStateAccepted      MessageState = 6
+	MessageStateUnknown       MessageState = 7
+	MessageStateRejected      MessageState = 8
+)
+
+var messageStateNames = map[MessageState]string{
+	MessageStateEnRoute:       "ENROUTE",
+	MessageStateDelivered:     "DELIVERED",
+	MessageStateExpired:       "EXPIRED",
+	MessageStateDeleted:       "DELETED",
+	MessageStateUndeliverable: "UNDELIVERABLE",
+	MessageStateAccepted:      "ACCEPTED",
+	MessageStateUnknown:       "UNKNOWN",
+	MessageStateRejected:      "REJECTED",
+}
+
+func (s MessageState) String() string {
+	if name, ok := messageStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageState(%d)", int(s))
+}
+
 // QuerySmResp holds response to query_sm PDU.
 type QuerySmResp struct {
 	MessageID    string
@@ -80,6 +113,11 @@ func (p QuerySmResp) CommandID() CommandID {
 	return QuerySmRespID
 }
 
+// State returns message_state as MessageState.
+func (p QuerySmResp) State() MessageState {
+	return MessageState(p.MessageState)
+}
+
 // MarshalBinary implements encoding.BinaryMarshaler interface.
 func (p QuerySmResp) MarshalBinary() ([]byte, error) {
 	out := append([]byte(p.MessageID), 0)
@@ -0,0 +1,30 @@
+package pdu
+
+import "testing"
+
+func TestQuerySmRespState(t *testing.T) {
+	tt := []struct {
+		state int
+		exp   MessageState
+		str   string
+	}{
+		{1, MessageStateEnRoute, "ENROUTE"},
+		{2, MessageStateDelivered, "DELIVERED"},
+		{3, MessageStateExpired, "EXPIRED"},
+		{4, MessageStateDeleted, "DELETED"},
+		{5, MessageStateUndeliverable, "UNDELIVERABLE"},
+		{6, MessageStateAccepted, "ACCEPTED"},
+		{7, MessageStateUnknown, "UNKNOWN"},
+		{8, MessageStateRejected, "REJECTED"},
+		{9, MessageState(9), "MessageState(9)"},
+	}
+	for _, tc := range tt {
+		resp := QuerySmResp{MessageState: tc.state}
+		if resp.State() != tc.exp {
+			t.Errorf("state %d: expected %v got %v", tc.state, tc.exp, resp.State())
+		}
+		if resp.State().String() != tc.str {
+			t.Errorf("state %d: expected %s got %s", tc.state, tc.str, resp.State())
+		}
+	}
+}
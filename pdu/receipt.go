@@ -3,6 +3,7 @@ package pdu
 import (
 	"errors"
 	"fmt"
+	"math/big"
 	"regexp"
 	"strings"
 	"time"
@@ -133,3 +134,161 @@ func ParseDeliveryReceipt(sm string) (*DeliveryReceipt, error) {
 	delRec.Text = sm[i+5:]
 	return &delRec, nil
 }
+
+// FromDeliverSm parses receipt from deliver_sm short_message, or message_payload
+// if short_message is empty, and overlays values from the optional parameters.
+// Optional parameters take precedence over the receipt text, so receipted_message_id,
+// message_state and network_error_code override Id, Stat and Err respectively.
+func (dr *DeliveryReceipt) FromDeliverSm(p *DeliverSm) error {
+	text := p.ShortMessage
+	if text == "" && p.Options != nil {
+		text = p.Options.MessagePayload()
+	}
+	rec, err := ParseDeliveryReceipt(text)
+	if err != nil {
+		return err
+	}
+	if p.Options != nil {
+		if id := p.Options.ReceiptedMessageID(); id != "" {
+			rec.Id = id
+		}
+		if stat, ok := DelStatMap[uint8(p.Options.MessageState())]; ok {
+			rec.Stat = stat
+		}
+		if _, code, ok := p.Options.NetworkErrorCode(); ok {
+			rec.Err = fmt.Sprintf("%03d", code)
+		}
+	}
+	*dr = *rec
+	return nil
+}
+
+// NormalizeMessageID trims surrounding whitespace from message id. Ids are
+// opaque strings so their case and leading zeros are preserved, use
+// ReceiptCorrelator with numeric IDFormat to compare ids across radixes.
+func NormalizeMessageID(id string) string {
+	return strings.TrimSpace(id)
+}
+
+// IDFormat describes how SMSC formats message ids.
+type IDFormat int
+
+const (
+	// IDFormatString ids are opaque strings compared after normalization.
+	IDFormatString IDFormat = iota
+	// IDFormatHex ids are hexadecimal numbers, optionally prefixed with 0x.
+	IDFormatHex
+	// IDFormatDecimal ids are decimal numbers.
+	IDFormatDecimal
+)
+
+// ReceiptCorrelator matches message id from submit_sm_resp with the id
+// from the delivery receipt when SMSC uses different formats for them.
+type ReceiptCorrelator struct {
+	// SubmitFormat is format of message_id in submit_sm_resp.
+	SubmitFormat IDFormat
+	// ReceiptFormat is format of id in delivery receipt.
+	ReceiptFormat IDFormat
+}
+
+// SubmitKey returns canonical representation of submit_sm_resp message id
+// which can be used as a key for looking up receipts.
+func (rc ReceiptCorrelator) SubmitKey(id string) string {
+	return messageIDKey(id, rc.SubmitFormat)
+}
+
+// ReceiptKey returns canonical representation of delivery receipt id
+// which can be compared with SubmitKey.
+func (rc ReceiptCorrelator) ReceiptKey(id string) string {
+	return messageIDKey(id, rc.ReceiptFormat)
+}
+
+// Match reports whether submit and receipt ids refer to the same message.
+func (rc ReceiptCorrelator) Match(submitID, receiptID string) bool {
+	return rc.SubmitKey(submitID) == rc.ReceiptKey(receiptID)
+}
+
+// messageIDKey converts numeric ids to decimal representation. Ids which
+// can't be parsed in the expected format are only normalized.
+func messageIDKey(id string, f IDFormat) string {
+	id = NormalizeMessageID(id)
+	base := 0
+	switch f {
+	case IDFormatHex:
+		base = 16
+		if strings.HasPrefix(id, "0x") || strings.HasPrefix(id, "0X") {
+			id = id[2:]
+		}
+	case IDFormatDecimal:
+		base = 10
+	default:
+		return id
+	}
+	n, ok := new(big.Int).SetString(id, base)
+	if !ok {
+		return id
+	}
+	return n.String()
+}
+
+// ReceiptInput holds result of the submitted message used for building
+// delivery receipt with BuildReceipts.
+type ReceiptInput struct {
+	// MessageID is the id returned in submit_sm_resp.
+	MessageID string
+	// Src and Dst are source and destination addresses of the original
+	// submit_sm. Receipt is sent back to Src so they are swapped in deliver_sm.
+	Src        string
+	Dst        string
+	Stat       DelStat
+	SubmitDate time.Time
+	DoneDate   time.Time
+	// Err is network specific error code placed in the err field of the receipt.
+	Err int
+}
+
+// BuildReceipts builds delivery receipt deliver_sm PDUs for the provided
+// submit results. Each receipt has esm_class set to SMSC delivery receipt
+// and carries receipted_message_id and message_state optional parameters.
+func BuildReceipts(results []ReceiptInput) []*DeliverSm {
+	out := make([]*DeliverSm, 0, len(results))
+	for _, r := range results {
+		out = append(out, buildReceipt(r))
+	}
+	return out
+}
+
+func buildReceipt(r ReceiptInput) *DeliverSm {
+	dlvrd := "000"
+	if r.Stat == DelStatDelivered {
+		dlvrd = "001"
+	}
+	rec := &DeliveryReceipt{
+		Id:         r.MessageID,
+		Sub:        "001",
+		Dlvrd:      dlvrd,
+		SubmitDate: r.SubmitDate,
+		DoneDate:   r.DoneDate,
+		Stat:       r.Stat,
+		Err:        fmt.Sprintf("%03d", r.Err),
+	}
+	opts := NewOptions().SetReceiptedMessageID(r.MessageID)
+	for state, stat := range DelStatMap {
+		if stat == r.Stat {
+			opts.SetMessageState(int(state))
+			break
+		}
+	}
+	p := &DeliverSm{
+		SourceAddr:      r.Dst,
+		DestinationAddr: r.Src,
+		EsmClass:        EsmClass{Type: DelRecEsmType},
+		Options:         opts,
+	}
+	if text := rec.String(); len(text) <= 254 {
+		p.ShortMessage = text
+	} else {
+		opts.SetMessagePayload(text)
+	}
+	return p
+}
@@ -57,3 +57,146 @@ func TestParsingUUIDDeliveryReceipt(t *testing.T) {
 		t.Errorf("ParseDeliveryReceipt() => %s expected %s", r.Stat, "DELIVRD")
 	}
 }
+
+func TestDeliveryReceiptFromDeliverSm(t *testing.T) {
+	p := &DeliverSm{
+		ShortMessage: "id:123 sub:001 dlvrd:001 submit date:1507011202 done date:1507011101 stat:DELIVRD err:000 text:-",
+		Options: NewOptions().
+			SetReceiptedMessageID("abc123").
+			SetMessageState(5).
+			SetNetworkErrorCode(3, 27),
+	}
+	dr := DeliveryReceipt{}
+	if err := dr.FromDeliverSm(p); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if dr.Id != "abc123" {
+		t.Errorf("Id => %s expected abc123", dr.Id)
+	}
+	if dr.Stat != DelStatUndeliverable {
+		t.Errorf("Stat => %s expected %s", dr.Stat, DelStatUndeliverable)
+	}
+	if dr.Err != "027" {
+		t.Errorf("Err => %s expected 027", dr.Err)
+	}
+	if dr.Sub != "001" {
+		t.Errorf("Sub => %s expected 001", dr.Sub)
+	}
+}
+
+func TestDeliverSmReceiptedMessageID(t *testing.T) {
+	text := "id:1A2B sub:001 dlvrd:001 submit date:1507011202 done date:1507011101 stat:DELIVRD err:000 text:-"
+	p := DeliverSm{
+		ShortMessage: text,
+		Options:      NewOptions().SetReceiptedMessageID("FF00"),
+	}
+	if id := p.ReceiptedMessageID(); id != "ff00" {
+		t.Errorf("ReceiptedMessageID() => %s expected ff00 from option", id)
+	}
+	p.Options = nil
+	if id := p.ReceiptedMessageID(); id != "1a2b" {
+		t.Errorf("ReceiptedMessageID() => %s expected 1a2b from text", id)
+	}
+	p.ShortMessage = "not a receipt"
+	if id := p.ReceiptedMessageID(); id != "" {
+		t.Errorf("ReceiptedMessageID() => %s expected empty", id)
+	}
+}
+
+func TestDeliverSmIsDeliveryReceipt(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		esm      EsmClass
+		expected bool
+	}{
+		{"delivery receipt", EsmClass{Type: DelRecEsmType}, true},
+		{"intermediate notification", EsmClass{Type: IDNEsmType}, true},
+		{"mobile originated", EsmClass{Type: DefaultEsmType}, false},
+		{"mobile originated with udhi", EsmClass{Type: DefaultEsmType, Feature: UDHIEsmFeat}, false},
+	} {
+		p := DeliverSm{EsmClass: tc.esm, ShortMessage: "id:1 stat:DELIVRD"}
+		if got := p.IsDeliveryReceipt(); got != tc.expected {
+			t.Errorf("%s: IsDeliveryReceipt() => %t expected %t", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestNormalizeMessageID(t *testing.T) {
+	for in, exp := range map[string]string{
+		"0x1A2B": "0x1A2B",
+		" 00ff ": "00ff",
+		"000":    "000",
+		"abc":    "abc",
+	} {
+		if got := NormalizeMessageID(in); got != exp {
+			t.Errorf("NormalizeMessageID(%q) => %q expected %q", in, got, exp)
+		}
+	}
+}
+
+func TestReceiptCorrelator(t *testing.T) {
+	rc := ReceiptCorrelator{SubmitFormat: IDFormatHex, ReceiptFormat: IDFormatDecimal}
+	if !rc.Match("0x1A2B", "6699") {
+		t.Errorf("expected hex 0x1A2B to match decimal 6699")
+	}
+	if rc.Match("0x1A2B", "6698") {
+		t.Errorf("expected hex 0x1A2B not to match decimal 6698")
+	}
+	if !rc.Match("001a2b", "06699") {
+		t.Errorf("expected numeric ids to match regardless of leading zeros")
+	}
+	var plain ReceiptCorrelator
+	if !plain.Match("a03ea27b", " a03ea27b") {
+		t.Errorf("expected equal ids to match")
+	}
+	if plain.Match("00A1", "a1") {
+		t.Errorf("expected opaque ids to be compared as is")
+	}
+	if plain.Match("1A2B", "6699") {
+		t.Errorf("expected string ids not to be converted")
+	}
+}
+
+func TestBuildReceipts(t *testing.T) {
+	submitted := time.Date(2020, 5, 1, 10, 30, 0, 0, time.UTC)
+	done := submitted.Add(time.Minute)
+	in := []ReceiptInput{
+		{MessageID: "id0", Src: "src0", Dst: "dst0", Stat: DelStatDelivered, SubmitDate: submitted, DoneDate: done},
+		{MessageID: "id1", Src: "src1", Dst: "dst1", Stat: DelStatUndeliverable, SubmitDate: submitted, DoneDate: done, Err: 34},
+	}
+	out := BuildReceipts(in)
+	if len(out) != len(in) {
+		t.Fatalf("BuildReceipts() => %d receipts expected %d", len(out), len(in))
+	}
+	for i, p := range out {
+		if p.SourceAddr != in[i].Dst || p.DestinationAddr != in[i].Src {
+			t.Errorf("receipt %d addressed from %s to %s", i, p.SourceAddr, p.DestinationAddr)
+		}
+		if p.EsmClass.Type != DelRecEsmType {
+			t.Errorf("receipt %d esm_class type %d expected %d", i, p.EsmClass.Type, DelRecEsmType)
+		}
+		if id := p.Options.ReceiptedMessageID(); id != in[i].MessageID {
+			t.Errorf("receipt %d receipted_message_id %s expected %s", i, id, in[i].MessageID)
+		}
+		if st := DelStatMap[uint8(p.Options.MessageState())]; st != in[i].Stat {
+			t.Errorf("receipt %d message_state %s expected %s", i, st, in[i].Stat)
+		}
+		if _, err := p.MarshalBinary(); err != nil {
+			t.Errorf("receipt %d marshal %v", i, err)
+		}
+		dr, err := ParseDeliveryReceipt(p.ShortMessage)
+		if err != nil {
+			t.Fatalf("receipt %d parse %v", i, err)
+		}
+		if dr.Id != in[i].MessageID || dr.Stat != in[i].Stat {
+			t.Errorf("receipt %d parsed id %s stat %s", i, dr.Id, dr.Stat)
+		}
+		if !dr.SubmitDate.Equal(submitted) || !dr.DoneDate.Equal(done) {
+			t.Errorf("receipt %d parsed dates %s %s", i, dr.SubmitDate, dr.DoneDate)
+		}
+	}
+	dr, _ := ParseDeliveryReceipt(out[1].ShortMessage)
+	if dr.Err != "034" || dr.Dlvrd != "000" {
+		t.Errorf("receipt err %s dlvrd %s expected 034 and 000", dr.Err, dr.Dlvrd)
+	}
+}
@@ -1,5 +1,7 @@
 package pdu
 
+import "encoding/binary"
+
 // Unbind defines unbind PDU.
 type Unbind struct{}
 
@@ -83,7 +85,15 @@ func (p EnquireLinkResp) UnmarshalBinary(body []byte) error {
 }
 
 // GenericNack PDU.
-type GenericNack struct{}
+//
+// Specification defines generic_nack without body. Some non-conformant
+// peers expect command_id and sequence_number of the offending PDU echoed
+// in the body, so they are encoded if OriginalCommandID or OriginalSequence
+// is set.
+type GenericNack struct {
+	OriginalCommandID CommandID
+	OriginalSequence  uint32
+}
 
 // CommandID implements pdu.PDU interface.
 func (p GenericNack) CommandID() CommandID {
@@ -92,10 +102,30 @@ func (p GenericNack) CommandID() CommandID {
 
 // MarshalBinary implements encoding.BinaryMarshaler interface.
 func (p GenericNack) MarshalBinary() ([]byte, error) {
-	return nil, nil
+	if p.OriginalCommandID == 0 && p.OriginalSequence == 0 {
+		return nil, nil
+	}
+	out := make([]byte, 8)
+	binary.BigEndian.PutUint32(out[:4], uint32(p.OriginalCommandID))
+	binary.BigEndian.PutUint32(out[4:], p.OriginalSequence)
+	return out, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler interface. It has
+// value receiver so GenericNack value implements PDU, echoed fields are
+// populated by the Decoder.
+func (p GenericNack) UnmarshalBinary(body []byte) error {
+	return nil
 }
 
-// UnmarshalBinary implements encoding.BinaryUnmarshaler interface.
-func (p GenericNack) UnmarshalBinary(body []byte) error {
+// unmarshalEcho decodes command_id and sequence_number of the offending PDU
+// echoed in the body.
+func (p *GenericNack) unmarshalEcho(body []byte) error {
+	if len(body) >= 4 {
+		p.OriginalCommandID = CommandID(binary.BigEndian.Uint32(body[:4]))
+	}
+	if len(body) >= 8 {
+		p.OriginalSequence = binary.BigEndian.Uint32(body[4:8])
+	}
 	return nil
 }
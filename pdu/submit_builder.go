@@ -0,0 +1,168 @@
+package pdu
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// concatRef is the last reference number used for concatenated messages.
+var concatRef uint32
+
+// SubmitBuilder builds submit_sm PDUs. Use NewSubmit to create it.
+type SubmitBuilder struct {
+	sm       SubmitSm
+	text     string
+	validFor time.Duration
+}
+
+// NewSubmit creates builder for submit_sm PDUs.
+//
+//	sms, err := pdu.NewSubmit().
+//		From(0x05, 0x00, "ACME").
+//		To(0x01, 0x01, "38160123456").
+//		Text("Hello").
+//		RequestReceipt().
+//		Build()
+func NewSubmit() *SubmitBuilder {
+	return &SubmitBuilder{}
+}
+
+// From sets source address.
+func (b *SubmitBuilder) From(ton, npi int, addr string) *SubmitBuilder {
+	b.sm.SourceAddrTon = ton
+	b.sm.SourceAddrNpi = npi
+	b.sm.SourceAddr = addr
+	return b
+}
+
+// To sets destination address.
+func (b *SubmitBuilder) To(ton, npi int, addr string) *SubmitBuilder {
+	b.sm.DestAddrTon = ton
+	b.sm.DestAddrNpi = npi
+	b.sm.DestinationAddr = addr
+	return b
+}
+
+// DataCoding sets data coding used for encoding the text. Defaults to
+// SMSC default alphabet which is switched to UCS2 if text can't be
+// encoded with GSM 7-bit alphabet.
+func (b *SubmitBuilder) DataCoding(coding int) *SubmitBuilder {
+	b.sm.DataCoding = coding
+	return b
+}
+
+// Text sets message text which is encoded according to the data coding.
+func (b *SubmitBuilder) Text(s string) *SubmitBuilder {
+	b.text = s
+	return b
+}
+
+// RequestReceipt requests SMSC delivery receipt for the message.
+func (b *SubmitBuilder) RequestReceipt() *SubmitBuilder {
+	b.sm.RegisteredDelivery.Receipt = YesDeliveryReceipt
+	return b
+}
+
+// ValidFor sets relative validity period of the message. Period is written
+// as relative time in days, hours, minutes and seconds so it can't be longer
+// than 99 days.
+func (b *SubmitBuilder) ValidFor(d time.Duration) *SubmitBuilder {
+	b.validFor = d
+	return b
+}
+
+// Build validates and returns submit_sm PDUs. Text that doesn't fit into
+// single message is split into multiple PDUs with concatenation user data
+// header.
+func (b *SubmitBuilder) Build() ([]*SubmitSm, error) {
+	if b.sm.DestinationAddr == "" {
+		return nil, errors.New("smpp/pdu: destination address is required")
+	}
+	coding, msg, err := encodeText(b.sm.DataCoding, b.text)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := b.sm
+	tmpl.DataCoding = coding
+	if b.validFor > 0 {
+		if tmpl.ValidityPeriodRaw, err = relativeTime(b.validFor); err != nil {
+			return nil, err
+		}
+	}
+	single, part := segmentLimits(coding)
+	var parts [][]byte
+	if len(msg) <= single {
+		parts = [][]byte{msg}
+	} else {
+		parts = splitMessage(coding, msg, part)
+	}
+	if len(parts) > 255 {
+		return nil, fmt.Errorf("smpp/pdu: text requires %d parts, at most 255 are allowed", len(parts))
+	}
+	ref := byte(atomic.AddUint32(&concatRef, 1))
+	out := make([]*SubmitSm, 0, len(parts))
+	for i, content := range parts {
+		sm := tmpl
+		sm.ShortMessageBytes = content
+		if len(parts) > 1 {
+			udh := []byte{0x05, 0x00, 0x03, ref, byte(len(parts)), byte(i + 1)}
+			if err := sm.SetUserDataHeader(udh); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := sm.MarshalBinary(); err != nil {
+			return nil, err
+		}
+		out = append(out, &sm)
+	}
+	return out, nil
+}
+
+// relativeTime formats duration as SMPP relative time. Fractions of second
+// are truncated.
+func relativeTime(d time.Duration) (string, error) {
+	days := d / (24 * time.Hour)
+	if days > 99 {
+		return "", fmt.Errorf("smpp/pdu: validity period %s exceeds 99 days", d)
+	}
+	d -= days * 24 * time.Hour
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	s := d % time.Minute / time.Second
+	return fmt.Sprintf("0000%02d%02d%02d%02d000R", days, h, m, s), nil
+}
+
+// segmentLimits returns maximum message length of single message and of
+// each part of the concatenated message which leaves room for the header.
+// GSM 7-bit and IA5 text is counted in unpacked septets.
+func segmentLimits(coding int) (int, int) {
+	switch coding {
+	case DataCodingDefault, DataCodingIA5:
+		return 160, 153
+	}
+	return 140, 134
+}
+
+// splitMessage splits encoded message into parts of up to size bytes
+// without breaking GSM 7-bit escape sequences or UCS2 surrogate pairs.
+func splitMessage(coding int, msg []byte, size int) [][]byte {
+	var parts [][]byte
+	for len(msg) > size {
+		n := size
+		switch coding {
+		case DataCodingDefault:
+			if msg[n-1] == 0x1B {
+				n--
+			}
+		case DataCodingUCS2:
+			if hi := msg[n-2]; hi >= 0xD8 && hi <= 0xDB {
+				n -= 2
+			}
+		}
+		parts = append(parts, msg[:n])
+		msg = msg[n:]
+	}
+	return append(parts, msg)
+}
@@ -0,0 +1,115 @@
+package pdu
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajankovic/smpp/encoding/ucs2"
+)
+
+func TestSubmitBuilderASCII(t *testing.T) {
+	sms, err := NewSubmit().
+		From(0x05, 0x00, "ACME").
+		To(0x01, 0x01, "38160123456").
+		Text("Hello world").
+		RequestReceipt().
+		ValidFor(time.Hour).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sms) != 1 {
+		t.Fatalf("Build() => %d PDUs expected 1", len(sms))
+	}
+	sm := sms[0]
+	if sm.SourceAddr != "ACME" || sm.SourceAddrTon != 0x05 || sm.DestinationAddr != "38160123456" || sm.DestAddrNpi != 0x01 {
+		t.Errorf("unexpected addresses %+v", sm)
+	}
+	if sm.DataCoding != DataCodingDefault || string(sm.Message()) != "Hello world" {
+		t.Errorf("unexpected content %d %q", sm.DataCoding, sm.Message())
+	}
+	if sm.RegisteredDelivery.Receipt != YesDeliveryReceipt {
+		t.Errorf("expected delivery receipt to be requested")
+	}
+	if sm.EsmClass.Feature&UDHIEsmFeat != 0 {
+		t.Errorf("single message shouldn't have udh")
+	}
+	b, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "000000010000000R\x00") {
+		t.Errorf("expected relative validity period in %q", b)
+	}
+}
+
+func TestSubmitBuilderValidFor(t *testing.T) {
+	for _, tc := range []struct {
+		d        time.Duration
+		expected string
+	}{
+		{time.Hour, "000000010000000R"},
+		{26*time.Hour + 30*time.Minute + 15*time.Second + 500*time.Millisecond, "000001023015000R"},
+		{99*24*time.Hour + 23*time.Hour, "000099230000000R"},
+	} {
+		sms, err := NewSubmit().To(0x01, 0x01, "38160123456").Text("Hi").ValidFor(tc.d).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sms[0].ValidityPeriodRaw; got != tc.expected {
+			t.Errorf("ValidFor(%s) => %s expected %s", tc.d, got, tc.expected)
+		}
+	}
+	if _, err := NewSubmit().To(0x01, 0x01, "38160123456").ValidFor(100 * 24 * time.Hour).Build(); err == nil {
+		t.Errorf("expected error for validity period over 99 days")
+	}
+}
+
+func TestSubmitBuilderLongUCS2(t *testing.T) {
+	text := strings.Repeat("Ћирилица ", 20)
+	sms, err := NewSubmit().
+		To(0x01, 0x01, "38160123456").
+		Text(text).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 180 characters take 360 bytes which is split into 134 byte parts.
+	if len(sms) != 3 {
+		t.Fatalf("Build() => %d PDUs expected 3", len(sms))
+	}
+	var content []byte
+	var ref byte
+	for i, sm := range sms {
+		if sm.DataCoding != DataCodingUCS2 {
+			t.Errorf("part %d data coding %d expected UCS2", i, sm.DataCoding)
+		}
+		udh, c, err := sm.UserDataHeader()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if len(udh) != 6 || udh[4] != 3 || udh[5] != byte(i+1) {
+			t.Errorf("part %d unexpected udh %X", i, udh)
+		}
+		if i == 0 {
+			ref = udh[3]
+		} else if udh[3] != ref {
+			t.Errorf("part %d reference %d expected %d", i, udh[3], ref)
+		}
+		if len(sm.Message()) > 140 {
+			t.Errorf("part %d length %d over 140", i, len(sm.Message()))
+		}
+		content = append(content, c...)
+	}
+	got, err := ucs2.Decode(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != text {
+		t.Errorf("reassembled text %q expected %q", got, text)
+	}
+	if _, err := NewSubmit().Text("no destination").Build(); err == nil {
+		t.Errorf("expected error for missing destination")
+	}
+}
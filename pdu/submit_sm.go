@@ -1,26 +1,49 @@
 package pdu
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"time"
 
 	smpptime "github.com/ajankovic/smpp/time"
 )
 
+// PayloadMode controls how message content is distributed between
+// short_message and message_payload when encoding SubmitSm.
+type PayloadMode int
+
+const (
+	// PayloadInline writes content into short_message. Content longer than
+	// 254 octets is written into message_payload leaving short_message empty.
+	PayloadInline PayloadMode = iota
+	// PayloadOnly writes content into message_payload leaving short_message empty.
+	PayloadOnly
+	// PayloadBoth writes content truncated to 254 octets into short_message
+	// and full content into message_payload.
+	PayloadBoth
+)
+
+// maxShortMessage is the maximum length of short_message field.
+const maxShortMessage = 254
+
 // SubmitSm contains mandatory fields for submiting short message.
 // There is no need to set SmLength it will be automatically set when
 // encoding pdu to binary representation.
-// Also long ShortMessages will be marshaled as payload in options.
+// Also long ShortMessages will be marshaled as payload in options,
+// see PayloadMode for details.
 type SubmitSm struct {
-	ServiceType          string
-	SourceAddrTon        int
-	SourceAddrNpi        int
-	SourceAddr           string
-	DestAddrTon          int
-	DestAddrNpi          int
-	DestinationAddr      string
-	EsmClass             EsmClass
-	ProtocolID           int
+	ServiceType     string
+	SourceAddrTon   int
+	SourceAddrNpi   int
+	SourceAddr      string
+	DestAddrTon     int
+	DestAddrNpi     int
+	DestinationAddr string
+	EsmClass        EsmClass
+	ProtocolID      int
+	// PriorityFlag is encoded as is, values other than PriorityLevel0-3 are
+	// only rejected when validated with Profile.
 	PriorityFlag         int
 	ScheduleDeliveryTime time.Time
 	ValidityPeriod       time.Time
@@ -29,7 +52,23 @@ type SubmitSm struct {
 	DataCoding           int
 	SmDefaultMsgID       int
 	ShortMessage         string
-	Options              *Options
+	// ScheduleDeliveryTimeRaw and ValidityPeriodRaw hold already formatted
+	// SMPP absolute or relative time. When set they are validated and written
+	// as they are instead of formatting ScheduleDeliveryTime and ValidityPeriod.
+	ScheduleDeliveryTimeRaw string
+	ValidityPeriodRaw       string
+	// TimeLayout is used for formatting ScheduleDeliveryTime and ValidityPeriod.
+	// Absolute time format is used when it's nil. Some SMSCs expect simple
+	// layouts instead.
+	TimeLayout *smpptime.Layout
+	// ShortMessageBytes holds raw message content. When not nil it takes
+	// precedence over ShortMessage during encoding. Decoding always sets
+	// ShortMessage so use Message to get raw content regardless of the field.
+	ShortMessageBytes []byte
+	// PayloadMode controls where message content is written during encoding.
+	// It's not set by decoding.
+	PayloadMode PayloadMode
+	Options     *Options
 }
 
 // CommandID implements pdu.PDU interface.
@@ -44,8 +83,103 @@ func (p SubmitSm) Response(msgID string) *SubmitSmResp {
 	}
 }
 
-// MarshalBinary implements encoding.BinaryMarshaler interface.
+// SetText encodes text according to DataCoding and assigns it to ShortMessage.
+// If DataCoding is SMSC default alphabet and text can't be encoded with GSM 7-bit
+// alphabet DataCoding is switched to UCS2. ShortMessageBytes is cleared since
+// it would otherwise take precedence over the text.
+func (p *SubmitSm) SetText(text string) error {
+	coding, b, err := encodeText(p.DataCoding, text)
+	if err != nil {
+		return err
+	}
+	p.DataCoding = coding
+	p.ShortMessage = string(b)
+	p.ShortMessageBytes = nil
+	return nil
+}
+
+// SetUserDataHeader prepends udh to message content and sets UDHI esm_class feature.
+// First byte of udh must hold the length of the remaining header bytes.
+func (p *SubmitSm) SetUserDataHeader(udh []byte) error {
+	if len(udh) < 2 || int(udh[0]) != len(udh)-1 {
+		return errors.New("smpp/pdu: invalid udh length")
+	}
+	if p.ShortMessageBytes != nil {
+		p.ShortMessageBytes = append(append([]byte{}, udh...), p.ShortMessageBytes...)
+	} else {
+		p.ShortMessage = string(udh) + p.ShortMessage
+	}
+	p.EsmClass.Feature |= UDHIEsmFeat
+	return nil
+}
+
+// UserDataHeader separates message content into user data header and message
+// content. If UDHI esm_class feature is not set udh is nil.
+func (p SubmitSm) UserDataHeader() ([]byte, []byte, error) {
+	if p.EsmClass.Feature&UDHIEsmFeat == 0 {
+		return nil, p.Message(), nil
+	}
+	return SeparateUDH(p.Message())
+}
+
+// validateReplace checks submit with replace rules. Replacing is supported only
+// in store and forward mode and the message being replaced is matched by
+// source_addr, destination_addr and service_type, so addresses must be set.
+// Unlike replace_sm which replaces message by its message_id, submit with
+// replace is keyed on the addresses.
+func (p SubmitSm) validateReplace() error {
+	switch p.ReplaceIfPresentFlag {
+	case 0:
+		return nil
+	case 1:
+	default:
+		return fmt.Errorf("smpp/pdu: invalid replace_if_present_flag %d", p.ReplaceIfPresentFlag)
+	}
+	if p.EsmClass.Mode != DefaultEsmMode && p.EsmClass.Mode != StoreAndForwardEsmMode {
+		return fmt.Errorf("smpp/pdu: replace_if_present_flag requires store and forward mode got esm_class mode %d", p.EsmClass.Mode)
+	}
+	if p.SourceAddr == "" || p.DestinationAddr == "" {
+		return errors.New("smpp/pdu: replace_if_present_flag requires source_addr and destination_addr to match the message")
+	}
+	return nil
+}
+
+// timeLayout returns TimeLayout or absolute layout if it's not set.
+func (p SubmitSm) timeLayout() smpptime.Layout {
+	if p.TimeLayout == nil {
+		return smpptime.Absolute
+	}
+	return *p.TimeLayout
+}
+
+// Message returns raw message content. ShortMessageBytes is returned when set,
+// otherwise bytes of ShortMessage.
+func (p SubmitSm) Message() []byte {
+	if p.ShortMessageBytes != nil {
+		return p.ShortMessageBytes
+	}
+	return []byte(p.ShortMessage)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler interface. Empty
+// destination_addr is rejected, use EncodeAllowEmptyDestination to permit it.
 func (p SubmitSm) MarshalBinary() ([]byte, error) {
+	return p.marshal(false)
+}
+
+func (p SubmitSm) marshal(allowEmptyDst bool) ([]byte, error) {
+	if len(p.ServiceType) > 5 {
+		return nil, fmt.Errorf("smpp/pdu: service_type %q longer than 5 characters", p.ServiceType)
+	}
+	if err := p.EsmClass.Validate(); err != nil {
+		return nil, err
+	}
+	if p.DestinationAddr == "" && !allowEmptyDst {
+		return nil, errors.New("smpp/pdu: destination_addr is required")
+	}
+	if err := p.validateReplace(); err != nil {
+		return nil, err
+	}
 	out := append(
 		[]byte(p.ServiceType),
 		0,
@@ -56,20 +190,27 @@ func (p SubmitSm) MarshalBinary() ([]byte, error) {
 	out = append(out, byte(p.DestAddrTon), byte(p.DestAddrNpi))
 	out = append(out, append([]byte(p.DestinationAddr), 0)...)
 	out = append(out, p.EsmClass.Byte(), byte(p.ProtocolID), byte(p.PriorityFlag))
-	tm, err := writeTime(smpptime.Absolute, p.ScheduleDeliveryTime)
+	tm, err := writeRawTime(p.ScheduleDeliveryTimeRaw, p.timeLayout(), p.ScheduleDeliveryTime)
 	if err != nil {
 		return nil, err
 	}
 	out = append(out, tm...)
-	tm, err = writeTime(smpptime.Absolute, p.ValidityPeriod)
+	tm, err = writeRawTime(p.ValidityPeriodRaw, p.timeLayout(), p.ValidityPeriod)
 	if err != nil {
 		return nil, err
 	}
 	out = append(out, tm...)
-	l := len(p.ShortMessage)
-	out = append(out, p.RegisteredDelivery.Byte(), byte(p.ReplaceIfPresentFlag), byte(p.DataCoding), byte(p.SmDefaultMsgID), byte(l))
-	if l > 0 {
-		out = append(out, []byte(p.ShortMessage)...)
+	sm, payload, err := p.splitPayload()
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, p.RegisteredDelivery.Byte(), byte(p.ReplaceIfPresentFlag), byte(p.DataCoding), byte(p.SmDefaultMsgID), byte(len(sm)))
+	out = append(out, sm...)
+	if payload != nil {
+		tlv := make([]byte, 4, 4+len(payload))
+		binary.BigEndian.PutUint16(tlv[:2], uint16(TagMessagePayload))
+		binary.BigEndian.PutUint16(tlv[2:4], uint16(len(payload)))
+		out = append(out, append(tlv, payload...)...)
 	}
 	if p.Options == nil {
 		return out, nil
@@ -81,12 +222,57 @@ func (p SubmitSm) MarshalBinary() ([]byte, error) {
 	return append(out, opts...), nil
 }
 
+// splitPayload returns content of short_message and message_payload according
+// to PayloadMode. Payload is nil if message_payload shouldn't be written.
+func (p SubmitSm) splitPayload() ([]byte, []byte, error) {
+	msg := p.Message()
+	if len(msg) == 0 {
+		return nil, nil, nil
+	}
+	var sm, payload []byte
+	switch p.PayloadMode {
+	case PayloadInline:
+		if len(msg) <= maxShortMessage {
+			return msg, nil, nil
+		}
+		payload = msg
+	case PayloadOnly:
+		payload = msg
+	case PayloadBoth:
+		sm = msg
+		if len(sm) > maxShortMessage {
+			sm = sm[:maxShortMessage]
+		}
+		payload = msg
+	default:
+		return nil, nil, fmt.Errorf("smpp/pdu: invalid payload mode %d", p.PayloadMode)
+	}
+	if len(payload) > 0xFFFF {
+		return nil, nil, fmt.Errorf("smpp/pdu: message length %d exceeds message_payload limit", len(payload))
+	}
+	if p.Options != nil {
+		if _, ok := p.Options.Get(TagMessagePayload); ok {
+			return nil, nil, errors.New("smpp/pdu: message_payload option already set")
+		}
+	}
+	return sm, payload, nil
+}
+
 // UnmarshalBinary implements encoding.BinaryUnmarshaler interface.
 func (p *SubmitSm) UnmarshalBinary(body []byte) error {
+	return p.unmarshal(body, false)
+}
+
+func (p *SubmitSm) unmarshalLenient(body []byte) error {
+	return p.unmarshal(body, true)
+}
+
+func (p *SubmitSm) unmarshal(body []byte, lenient bool) error {
 	if len(body) < 25 {
 		return fmt.Errorf("smpp/pdu: submit_sm body too short: %d", len(body))
 	}
 	buf := newBuffer(body)
+	buf.lenient = lenient
 	res, err := buf.ReadCString(6)
 	if err != nil {
 		return fmt.Errorf("smpp/pdu: decoding service_type %s", err)
@@ -0,0 +1,386 @@
+package pdu
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	smpptime "github.com/ajankovic/smpp/time"
+)
+
+func TestSubmitSmSetText(t *testing.T) {
+	tt := []struct {
+		name     string
+		coding   int
+		text     string
+		expCod   int
+		expBytes []byte
+		err      bool
+	}{
+		{"gsm7", DataCodingDefault, "a@{", DataCodingDefault, []byte{0x61, 0x00, 0x1B, 0x28}, false},
+		{"gsm7 fallback to ucs2", DataCodingDefault, "Жa", DataCodingUCS2, []byte{0x04, 0x16, 0x00, 0x61}, false},
+		{"ia5", DataCodingIA5, "abc", DataCodingIA5, []byte("abc"), false},
+		{"ia5 non-ascii", DataCodingIA5, "café", DataCodingIA5, nil, true},
+		{"latin1", DataCodingLatin1, "café", DataCodingLatin1, []byte{'c', 'a', 'f', 0xE9}, false},
+		{"ucs2", DataCodingUCS2, "é", DataCodingUCS2, []byte{0x00, 0xE9}, false},
+		{"unsupported", DataCodingBinary, "abc", DataCodingBinary, nil, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &SubmitSm{DataCoding: tc.coding, ShortMessageBytes: []byte("previous")}
+			err := p.SetText(tc.text)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if p.DataCoding != tc.expCod {
+				t.Errorf("DataCoding => 0x%02X expected 0x%02X", p.DataCoding, tc.expCod)
+			}
+			if !bytes.Equal([]byte(p.ShortMessage), tc.expBytes) {
+				t.Errorf("ShortMessage => % X expected % X", p.ShortMessage, tc.expBytes)
+			}
+			if !bytes.Equal(p.Message(), tc.expBytes) {
+				t.Errorf("Message() => % X expected % X", p.Message(), tc.expBytes)
+			}
+		})
+	}
+}
+
+func TestSubmitSmDump(t *testing.T) {
+	p := &SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "hello",
+		Options: NewOptions().
+			SetUserMessageReference(111).
+			SetMessagePayload("payload"),
+	}
+	out := Dump(p)
+	for _, exp := range []string{
+		"SubmitSm{",
+		`SourceAddr:"source"`,
+		`ShortMessage:"hello"`,
+		"TagUserMessageReference:111",
+		`TagMessagePayload:"payload"`,
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("Dump() => %s\nexpected to contain %s", out, exp)
+		}
+	}
+}
+
+func TestSubmitSmPriorityFlag(t *testing.T) {
+	for _, prio := range []int{PriorityLevel0, PriorityLevel1, PriorityLevel2, PriorityLevel3} {
+		p := SubmitSm{DestinationAddr: "222", PriorityFlag: prio}
+		if _, err := p.MarshalBinary(); err != nil {
+			t.Errorf("priority %d: unexpected error %s", prio, err)
+		}
+	}
+	// Out of range priority is only rejected by profile validation.
+	p := SubmitSm{DestinationAddr: "222", PriorityFlag: 4}
+	if _, err := p.MarshalBinary(); err != nil {
+		t.Errorf("priority 4: unexpected error %s", err)
+	}
+	if err := ProfileNone.Validate(&p); err != nil {
+		t.Errorf("priority 4: unexpected error without profile %s", err)
+	}
+	if err := ProfileGSM.Validate(&p); err == nil {
+		t.Errorf("priority 4: expected error got nil")
+	}
+}
+
+func TestSubmitSmEmptyDestination(t *testing.T) {
+	p := SubmitSm{SourceAddr: "111", ShortMessage: "Hello"}
+	_, err := p.MarshalBinary()
+	if err == nil || !strings.Contains(err.Error(), "destination_addr") {
+		t.Errorf("expected destination_addr error got %v", err)
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, nil)
+	if _, err := enc.Encode(&p); err == nil {
+		t.Errorf("expected destination_addr error got nil")
+	}
+	if _, err := enc.Encode(&p, EncodeAllowEmptyDestination()); err != nil {
+		t.Errorf("unexpected error with EncodeAllowEmptyDestination %s", err)
+	}
+	if buf.Len() == 0 {
+		t.Errorf("expected submit_sm to be written")
+	}
+}
+
+func TestSubmitSmUserDataHeader(t *testing.T) {
+	// Application port addressing scheme with 16 bit port numbers.
+	udh := []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0}
+	p := &SubmitSm{ShortMessage: "push"}
+	if err := p.SetUserDataHeader(udh); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if b := p.EsmClass.Byte(); b != 0x40 {
+		t.Errorf("esm_class => 0x%02X expected 0x40", b)
+	}
+	if p.ShortMessage[0] != 0x06 {
+		t.Errorf("udh length prefix => 0x%02X expected 0x06", p.ShortMessage[0])
+	}
+	h, msg, err := p.UserDataHeader()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !bytes.Equal(h, udh) {
+		t.Errorf("UserDataHeader() udh => % X expected % X", h, udh)
+	}
+	if string(msg) != "push" {
+		t.Errorf("UserDataHeader() message => %q expected %q", msg, "push")
+	}
+	if err := (&SubmitSm{}).SetUserDataHeader([]byte{0x05, 0x00, 0x03}); err == nil {
+		t.Errorf("expected error for mismatched udh length")
+	}
+}
+
+func TestSubmitSmShortMessageBytes(t *testing.T) {
+	payload := []byte{0x00, 0x06, 0x01, 0x00, 0xAE, 0x00}
+	p := SubmitSm{
+		SourceAddr:        "123",
+		DestinationAddr:   "456",
+		ShortMessage:      "ignored",
+		ShortMessageBytes: payload,
+		DataCoding:        DataCodingBinary,
+	}
+	body, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var got SubmitSm
+	if err := got.UnmarshalBinary(body); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !bytes.Equal(got.Message(), payload) {
+		t.Errorf("Message() => %v expected %v", got.Message(), payload)
+	}
+	if got.ShortMessage != string(payload) {
+		t.Errorf("ShortMessage => %q expected %q", got.ShortMessage, payload)
+	}
+	d := DeliverSm{SourceAddr: "123", DestinationAddr: "456", ShortMessageBytes: payload}
+	body, err = d.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var gotD DeliverSm
+	if err := gotD.UnmarshalBinary(body); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !bytes.Equal(gotD.Message(), payload) {
+		t.Errorf("Message() => %v expected %v", gotD.Message(), payload)
+	}
+}
+
+func TestSubmitSmRawTimes(t *testing.T) {
+	p := SubmitSm{
+		SourceAddr:              "123",
+		DestinationAddr:         "456",
+		ScheduleDeliveryTimeRaw: "200102030405600+",
+		ValidityPeriodRaw:       "000001000000000R",
+	}
+	body, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	for _, raw := range []string{p.ScheduleDeliveryTimeRaw, p.ValidityPeriodRaw} {
+		if !bytes.Contains(body, append([]byte(raw), 0)) {
+			t.Errorf("MarshalBinary() => %q doesn't contain %q", body, raw)
+		}
+	}
+	var got SubmitSm
+	if err := got.UnmarshalBinary(body); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if got.ValidityPeriod.IsZero() {
+		t.Errorf("expected decoded validity period")
+	}
+	p.ValidityPeriodRaw = "000001000000000X"
+	if _, err := p.MarshalBinary(); err == nil {
+		t.Errorf("expected error for invalid raw time")
+	}
+}
+
+func TestSubmitSmTrailingPadding(t *testing.T) {
+	p := SubmitSm{
+		SourceAddr:      "123",
+		DestinationAddr: "456",
+		ShortMessage:    "hi",
+		Options:         NewOptions().SetUserMessageReference(7),
+	}
+	body, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var got SubmitSm
+	if err := got.UnmarshalBinary(append(body, 0, 0)); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if ref, ok := got.Options.GetDouble(TagUserMessageReference); !ok || ref != 7 {
+		t.Errorf("user_message_reference => %d %t expected 7", ref, ok)
+	}
+	if err := got.UnmarshalBinary(append(body, 0, 1)); err == nil {
+		t.Errorf("expected error for non-zero trailing bytes")
+	}
+}
+
+func TestSubmitSmReplaceIfPresent(t *testing.T) {
+	tt := []struct {
+		name string
+		p    SubmitSm
+		err  bool
+	}{
+		{"store and forward replace", SubmitSm{
+			SourceAddr: "123", DestinationAddr: "456", ReplaceIfPresentFlag: 1,
+			EsmClass: EsmClass{Mode: StoreAndForwardEsmMode},
+		}, false},
+		{"default mode replace", SubmitSm{
+			SourceAddr: "123", DestinationAddr: "456", ReplaceIfPresentFlag: 1,
+		}, false},
+		{"datagram replace", SubmitSm{
+			SourceAddr: "123", DestinationAddr: "456", ReplaceIfPresentFlag: 1,
+			EsmClass: EsmClass{Mode: DatagramEsmMode},
+		}, true},
+		{"replace without source", SubmitSm{
+			DestinationAddr: "456", ReplaceIfPresentFlag: 1,
+		}, true},
+		{"reserved flag", SubmitSm{
+			SourceAddr: "123", DestinationAddr: "456", ReplaceIfPresentFlag: 2,
+		}, true},
+	}
+	for _, tc := range tt {
+		_, err := tc.p.MarshalBinary()
+		if tc.err && err == nil {
+			t.Errorf("%s: expected error got nil", tc.name)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error %s", tc.name, err)
+		}
+	}
+}
+
+func TestSubmitSmPayloadMode(t *testing.T) {
+	short := "hello"
+	long := strings.Repeat("a", 300)
+	tt := []struct {
+		name     string
+		mode     PayloadMode
+		msg      string
+		smLength int
+		payload  string
+	}{
+		{"inline", PayloadInline, short, len(short), ""},
+		{"inline long", PayloadInline, long, 0, long},
+		{"payload only", PayloadOnly, short, 0, short},
+		{"both", PayloadBoth, short, len(short), short},
+		{"both long", PayloadBoth, long, 254, long},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p := SubmitSm{
+				SourceAddr:      "source",
+				DestinationAddr: "destination",
+				ShortMessage:    tc.msg,
+				PayloadMode:     tc.mode,
+			}
+			b, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := &SubmitSm{}
+			if err := dec.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if len(dec.ShortMessage) != tc.smLength {
+				t.Errorf("sm_length %d expected %d", len(dec.ShortMessage), tc.smLength)
+			}
+			if dec.ShortMessage != tc.msg[:tc.smLength] {
+				t.Errorf("short_message %q expected %q", dec.ShortMessage, tc.msg[:tc.smLength])
+			}
+			var payload string
+			if dec.Options != nil {
+				payload = dec.Options.MessagePayload()
+			}
+			if payload != tc.payload {
+				t.Errorf("message_payload %q expected %q", payload, tc.payload)
+			}
+		})
+	}
+	p := SubmitSm{
+		ShortMessage: short,
+		PayloadMode:  PayloadOnly,
+		Options:      NewOptions().SetMessagePayload(short),
+	}
+	if _, err := p.MarshalBinary(); err == nil {
+		t.Errorf("expected error when message_payload is already set")
+	}
+}
+
+func TestSubmitSmTimeLayout(t *testing.T) {
+	sched := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	layout := smpptime.SimpleMinutes
+	p := SubmitSm{
+		SourceAddr:           "123",
+		DestinationAddr:      "456",
+		ScheduleDeliveryTime: sched,
+		ValidityPeriod:       sched.Add(time.Hour),
+		TimeLayout:           &layout,
+	}
+	body, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	// Addresses are followed by esm_class, protocol_id and priority_flag.
+	expected := []byte("123\x00\x00\x00456\x00\x00\x00\x00" + "2001020304\x00" + "2001020404\x00")
+	if !bytes.Contains(body, expected) {
+		t.Errorf("MarshalBinary() => %q doesn't contain %q", body, expected)
+	}
+	p.TimeLayout = nil
+	body, err = p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !bytes.Contains(body, []byte("200102030405000+\x00")) {
+		t.Errorf("MarshalBinary() => %q doesn't contain absolute time", body)
+	}
+}
+
+func TestSubmitSmLenientServiceType(t *testing.T) {
+	sm := &SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "hello",
+	}
+	body, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace empty service_type with 7 characters long one.
+	body = append([]byte("LONGSRV\x00"), body[1:]...)
+	frame := append(
+		[]byte{0x00, 0x00, 0x00, byte(16 + len(body)), 0x00, 0x00, 0x00, 0x04, 0, 0, 0, 0, 0, 0, 0, 1},
+		body...,
+	)
+	if _, _, err := NewDecoder(bytes.NewReader(frame)).Decode(); !errors.Is(err, ErrBodyDecode) {
+		t.Errorf("expected body decode error got %v", err)
+	}
+	_, p, err := NewDecoder(bytes.NewReader(frame), DecodeLenient()).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := p.(*SubmitSm)
+	if decoded.ServiceType != "LONGSRV" || decoded.DestinationAddr != "destination" || decoded.ShortMessage != "hello" {
+		t.Errorf("unexpected lenient decoding result %+v", decoded)
+	}
+	if _, err := decoded.MarshalBinary(); err == nil || !strings.Contains(err.Error(), "service_type") {
+		t.Errorf("expected service_type length error got %v", err)
+	}
+}
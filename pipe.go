@@ -0,0 +1,67 @@
+package smpp
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var errPipeListenerClosed = errors.New("smpp: pipe listener closed")
+
+// PipeListener creates in-memory listener and dial function connected to it.
+// Each dial creates net.Pipe whose other end is returned from Accept. It's
+// useful for testing servers without binding real ports, e.g. by passing the
+// listener to Server.Serve and the dialed connection to BindTRxConn.
+func PipeListener() (net.Listener, func() (net.Conn, error)) {
+	ln := &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	return ln, ln.dial
+}
+
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (ln *pipeListener) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case ln.conns <- server:
+		return client, nil
+	case <-ln.done:
+		client.Close()
+		server.Close()
+		return nil, errPipeListenerClosed
+	}
+}
+
+// Accept implements net.Listener interface.
+func (ln *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ln.conns:
+		return conn, nil
+	case <-ln.done:
+		return nil, errPipeListenerClosed
+	}
+}
+
+// Close implements net.Listener interface.
+func (ln *pipeListener) Close() error {
+	ln.once.Do(func() {
+		close(ln.done)
+	})
+	return nil
+}
+
+// Addr implements net.Listener interface.
+func (ln *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
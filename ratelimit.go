@@ -0,0 +1,80 @@
+package smpp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing bursts of up to one second worth
+// of tokens.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSec int) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(perSec),
+		tokens: float64(perSec),
+		last:   time.Now(),
+	}
+}
+
+// refill adds tokens accumulated since the last refill.
+//
+// Must be guarded by mutex.
+func (rl *rateLimiter) refill() {
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.rate {
+		rl.tokens = rl.rate
+	}
+	rl.last = now
+}
+
+// take takes a token from the bucket without blocking. It reports false
+// if no token is available.
+func (rl *rateLimiter) take() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.refill()
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+	return true
+}
+
+// put returns token which was taken for the request that wasn't sent.
+func (rl *rateLimiter) put() {
+	rl.mu.Lock()
+	rl.tokens++
+	rl.mu.Unlock()
+}
+
+// wait takes a token from the bucket blocking until one is available
+// or context is done.
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	rl.mu.Lock()
+	rl.refill()
+	rl.tokens--
+	if rl.tokens >= 0 {
+		rl.mu.Unlock()
+		return nil
+	}
+	delay := time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	rl.mu.Unlock()
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Return reserved token.
+		rl.put()
+		return ctx.Err()
+	}
+}
@@ -7,12 +7,23 @@ import (
 	"time"
 )
 
+// defaultKeepAlivePeriod is used when server doesn't set KeepAlivePeriod.
+const defaultKeepAlivePeriod = 3 * time.Minute
+
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by ListenAndServe and ListenAndServeTLS so
 // dead TCP connections (e.g. closing laptop mid-download) eventually
 // go away.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
+	keepAlive bool
+	period    time.Duration
+}
+
+// keepAliveConn is implemented by *net.TCPConn.
+type keepAliveConn interface {
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
 }
 
 func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
@@ -20,15 +31,29 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 	if err != nil {
 		return
 	}
-	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
+	ln.configure(tc)
 	return tc, nil
 }
 
+func (ln tcpKeepAliveListener) configure(c keepAliveConn) {
+	if !ln.keepAlive {
+		c.SetKeepAlive(false)
+		return
+	}
+	c.SetKeepAlive(true)
+	c.SetKeepAlivePeriod(ln.period)
+}
+
 // Server implements SMPP SMSC server.
 type Server struct {
 	Addr        string
 	SessionConf *SessionConf
+	// DisableKeepAlive turns off TCP keep-alive on connections accepted by
+	// ListenAndServe. Keep-alive is enabled by default.
+	DisableKeepAlive bool
+	// KeepAlivePeriod sets period between TCP keep-alive probes. Lower it
+	// for networks dropping idle flows sooner. Defaults to 3 minutes.
+	KeepAlivePeriod time.Duration
 
 	wg         sync.WaitGroup
 	mu         sync.Mutex
@@ -57,10 +82,23 @@ func (srv *Server) ListenAndServe() error {
 		return err
 	}
 
-	return srv.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
+	return srv.Serve(srv.keepAliveListener(ln.(*net.TCPListener)))
+}
+
+func (srv *Server) keepAliveListener(ln *net.TCPListener) tcpKeepAliveListener {
+	period := srv.KeepAlivePeriod
+	if period == 0 {
+		period = defaultKeepAlivePeriod
+	}
+	return tcpKeepAliveListener{
+		TCPListener: ln,
+		keepAlive:   !srv.DisableKeepAlive,
+		period:      period,
+	}
 }
 
-// Serve accepts incoming connections and starts SMPP sessions.
+// Serve accepts incoming connections and starts SMPP sessions. Any
+// net.Listener can be used, including in-memory one from PipeListener.
 func (srv *Server) Serve(ln net.Listener) error {
 	defer ln.Close()
 	srv.trackListener(ln, true)
@@ -106,16 +144,119 @@ func (srv *Server) Serve(ln net.Listener) error {
 	}
 }
 
+// ServeContext is like Serve but it also stops when context is done. Server
+// is closed the same way as with Close and ServeContext returns only after
+// all sessions are closed.
+func (srv *Server) ServeContext(ctx context.Context, ln net.Listener) error {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			srv.Close()
+		case <-done:
+		}
+	}()
+	err := srv.Serve(ln)
+	close(done)
+	<-stopped
+	return err
+}
+
+// UnbindResult holds outcome of unbinding single session.
+type UnbindResult struct {
+	SessionID string
+	// SystemID is the one reported by the peer during binding.
+	SystemID string
+	Err      error
+}
+
 // Unbind gracefully closes server by sending Unbind requests to all connected peers.
-func (srv *Server) Unbind(ctx context.Context) error {
+// Unbind requests are sent concurrently and outcome for each session is returned.
+// All sessions are closed regardless of unbind outcome.
+func (srv *Server) Unbind(ctx context.Context) ([]UnbindResult, error) {
 	srv.mu.Lock()
+	sessions := make([]*Session, 0, len(srv.activeSess))
 	for sess := range srv.activeSess {
-		Unbind(ctx, sess)
+		sessions = append(sessions, sess)
 	}
 	srv.mu.Unlock()
+	results := make([]UnbindResult, len(sessions))
+	var wg sync.WaitGroup
+	for i, sess := range sessions {
+		wg.Add(1)
+		go func(i int, sess *Session) {
+			defer wg.Done()
+			results[i] = UnbindResult{
+				SessionID: sess.ID(),
+				SystemID:  sess.PeerSystemID(),
+			}
+			results[i].Err = Unbind(ctx, sess)
+		}(i, sess)
+	}
+	wg.Wait()
+	return results, srv.Close()
+}
+
+// Shutdown gracefully closes server by draining all active sessions before
+// closing them. Sessions are given until context is done to receive responses
+// to their outstanding requests.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	sessions := make([]*Session, 0, len(srv.activeSess))
+	for sess := range srv.activeSess {
+		sessions = append(sessions, sess)
+	}
+	srv.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func(sess *Session) {
+			defer wg.Done()
+			sess.Drain(ctx)
+		}(sess)
+	}
+	wg.Wait()
 	return srv.Close()
 }
 
+// SessionInfo is a snapshot of the active session.
+type SessionInfo struct {
+	SessionID  string
+	SystemID   string
+	RemoteAddr string
+	State      SessionState
+	BoundAt    time.Time
+	// InFlight is the number of sent requests waiting for the response.
+	InFlight int
+}
+
+// SessionInfo returns snapshot of all active sessions. SystemID is the one
+// reported by the peer during binding.
+func (srv *Server) SessionInfo() []SessionInfo {
+	srv.mu.Lock()
+	sessions := make([]*Session, 0, len(srv.activeSess))
+	for sess := range srv.activeSess {
+		sessions = append(sessions, sess)
+	}
+	srv.mu.Unlock()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		sess.mu.Lock()
+		infos = append(infos, SessionInfo{
+			SessionID:  sess.ID(),
+			SystemID:   sess.systemID,
+			RemoteAddr: sess.remoteAddr(),
+			State:      sess.state,
+			BoundAt:    sess.boundAt,
+			InFlight:   len(sess.sent),
+		})
+		sess.mu.Unlock()
+	}
+	return infos
+}
+
 // Close implements closer interface.
 func (srv *Server) Close() error {
 	srv.mu.Lock()
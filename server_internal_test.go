@@ -0,0 +1,53 @@
+package smpp
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeKeepAliveConn struct {
+	keepAlive bool
+	period    time.Duration
+}
+
+func (c *fakeKeepAliveConn) SetKeepAlive(keepalive bool) error {
+	c.keepAlive = keepalive
+	return nil
+}
+
+func (c *fakeKeepAliveConn) SetKeepAlivePeriod(d time.Duration) error {
+	c.period = d
+	return nil
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	// Zero value server keeps TCP keep-alive enabled.
+	srv := &Server{}
+	conn := &fakeKeepAliveConn{}
+	srv.keepAliveListener(nil).configure(conn)
+	if !conn.keepAlive || conn.period != defaultKeepAlivePeriod {
+		t.Errorf("keep-alive => %t %s expected true %s", conn.keepAlive, conn.period, defaultKeepAlivePeriod)
+	}
+
+	srv = NewServer("", SessionConf{})
+	srv.KeepAlivePeriod = 45 * time.Second
+	conn = &fakeKeepAliveConn{}
+	srv.keepAliveListener(nil).configure(conn)
+	if !conn.keepAlive || conn.period != 45*time.Second {
+		t.Errorf("keep-alive => %t %s expected true 45s", conn.keepAlive, conn.period)
+	}
+
+	srv.KeepAlivePeriod = 0
+	conn = &fakeKeepAliveConn{}
+	srv.keepAliveListener(nil).configure(conn)
+	if conn.period != defaultKeepAlivePeriod {
+		t.Errorf("keep-alive period => %s expected default %s", conn.period, defaultKeepAlivePeriod)
+	}
+
+	srv.DisableKeepAlive = true
+	conn = &fakeKeepAliveConn{keepAlive: true}
+	srv.keepAliveListener(nil).configure(conn)
+	if conn.keepAlive || conn.period != 0 {
+		t.Errorf("keep-alive => %t %s expected disabled", conn.keepAlive, conn.period)
+	}
+}
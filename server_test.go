@@ -66,10 +66,18 @@ func TestSMPPServer(t *testing.T) {
 	}))
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
-	err := srv.Unbind(ctx)
+	results, err := srv.Unbind(ctx)
 	if err != nil {
 		t.Error(err.Error())
 	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 unbind results got %d", len(results))
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			t.Errorf("session %s failed to unbind %v", res.SessionID, res.Err)
+		}
+	}
 	select {
 	case <-sess1.NotifyClosed():
 	case <-time.After(100 * time.Millisecond):
@@ -97,3 +105,214 @@ func bindToServer(bind string, hf smpp.HandlerFunc) *smpp.Session {
 	}
 	return sess
 }
+
+func TestSMPPServerUnbindResults(t *testing.T) {
+	sessConf := smpp.SessionConf{
+		// Results must report peer's system_id, not the server's one.
+		SystemID: "TestingServer",
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				btrx, err := ctx.BindTRx()
+				if err != nil {
+					t.Errorf(err.Error())
+				}
+				resp := btrx.Response("TestingServer")
+				if err := ctx.Respond(resp, pdu.StatusOK); err != nil {
+					t.Errorf(err.Error())
+				}
+			}
+		}),
+	}
+	ln, dial := smpp.PipeListener()
+	srv := smpp.NewServer("", sessConf)
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			t.Errorf("Expected no error on server close %v", err)
+		}
+	}()
+	defer srv.Close()
+	bind := func(systemID string, hf smpp.HandlerFunc) *smpp.Session {
+		conn, err := dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess, err := smpp.BindTRxConn(conn, smpp.SessionConf{Handler: hf}, smpp.BindConf{SystemID: systemID})
+		if err != nil {
+			t.Fatalf("error during bind %v", err)
+		}
+		return sess
+	}
+	cooperative := bind("Cooperative", smpp.HandlerFunc(func(ctx *smpp.Context) {
+		if ctx.CommandID() == pdu.UnbindID {
+			ubd, err := ctx.Unbind()
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			if err := ctx.Respond(ubd.Response(), pdu.StatusOK); err != nil {
+				t.Errorf(err.Error())
+			}
+		}
+	}))
+	defer cooperative.Close()
+	silent := bind("Silent", smpp.HandlerFunc(func(ctx *smpp.Context) {}))
+	defer silent.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results, err := srv.Unbind(ctx)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 unbind results got %d", len(results))
+	}
+	for _, res := range results {
+		switch res.SystemID {
+		case "Cooperative":
+			if res.Err != nil {
+				t.Errorf("expected cooperative session to unbind got %v", res.Err)
+			}
+		case "Silent":
+			if res.Err == nil {
+				t.Errorf("expected error for silent session")
+			}
+		default:
+			t.Errorf("unexpected result %+v", res)
+		}
+	}
+}
+
+func TestSMPPServerSessionInfo(t *testing.T) {
+	sessConf := smpp.SessionConf{
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.BindTransceiverID {
+				if err := ctx.AcceptBind("TestingServer"); err != nil {
+					t.Errorf(err.Error())
+				}
+			}
+		}),
+	}
+	ln, dial := smpp.PipeListener()
+	srv := smpp.NewServer("", sessConf)
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			t.Errorf("Expected no error on server close %v", err)
+		}
+	}()
+	defer srv.Close()
+	for _, systemID := range []string{"One", "Two"} {
+		conn, err := dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess, err := smpp.BindTRxConn(conn, smpp.SessionConf{}, smpp.BindConf{SystemID: systemID})
+		if err != nil {
+			t.Fatalf("error during bind %v", err)
+		}
+		defer sess.Close()
+	}
+	infos := srv.SessionInfo()
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 sessions got %d", len(infos))
+	}
+	seen := map[string]bool{}
+	for _, info := range infos {
+		seen[info.SystemID] = true
+		if info.State != smpp.StateBoundTRx {
+			t.Errorf("session %s state => %s expected %s", info.SystemID, info.State, smpp.StateBoundTRx)
+		}
+		if info.BoundAt.IsZero() {
+			t.Errorf("session %s has no bind time", info.SystemID)
+		}
+		if info.RemoteAddr == "" {
+			t.Errorf("session %s has no remote address", info.SystemID)
+		}
+	}
+	if !seen["One"] || !seen["Two"] {
+		t.Errorf("expected sessions One and Two got %+v", infos)
+	}
+}
+
+func TestSMPPServerPipeListener(t *testing.T) {
+	sessConf := smpp.SessionConf{
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.BindTransceiverID {
+				if err := ctx.AcceptBind("TestingServer"); err != nil {
+					t.Errorf(err.Error())
+				}
+			}
+		}),
+	}
+	ln, dial := smpp.PipeListener()
+	srv := smpp.NewServer("", sessConf)
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+	conn, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := smpp.BindTRxConn(conn, smpp.SessionConf{}, smpp.BindConf{SystemID: "Client"})
+	if err != nil {
+		t.Fatalf("error during bind %v", err)
+	}
+	if id := sess.PeerSystemID(); id != "TestingServer" {
+		t.Errorf("PeerSystemID() => %q expected TestingServer", id)
+	}
+	if err := srv.Close(); err != nil {
+		t.Errorf("unexpected error on server close %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected no error on server close %v", err)
+	}
+	<-sess.NotifyClosed()
+	if _, err := dial(); err == nil {
+		t.Errorf("expected error dialing closed listener")
+	}
+}
+
+func TestSMPPServerServeContext(t *testing.T) {
+	sessConf := smpp.SessionConf{
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.BindTransceiverID {
+				if err := ctx.AcceptBind("TestingServer"); err != nil {
+					t.Errorf(err.Error())
+				}
+			}
+		}),
+	}
+	ln, dial := smpp.PipeListener()
+	srv := smpp.NewServer("", sessConf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error)
+	go func() {
+		served <- srv.ServeContext(ctx, ln)
+	}()
+	conn, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := smpp.BindTRxConn(conn, smpp.SessionConf{}, smpp.BindConf{SystemID: "Client"})
+	if err != nil {
+		t.Fatalf("error during bind %v", err)
+	}
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Expected no error on context cancel %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeContext didn't return after context cancel")
+	}
+	if infos := srv.SessionInfo(); len(infos) != 0 {
+		t.Errorf("expected no active sessions got %d", len(infos))
+	}
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(time.Second):
+		t.Fatal("client session wasn't closed")
+	}
+}
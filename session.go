@@ -1,6 +1,6 @@
 package smpp
 
-//go:generate stringer -type=SessionState,SessionType
+//go:generate stringer -type=SessionState,SessionType,CloseReason
 
 import (
 	"context"
@@ -12,6 +12,7 @@ import (
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ajankovic/smpp/pdu"
@@ -38,6 +39,21 @@ func (e Error) Temporary() bool {
 	return e.Temp
 }
 
+var (
+	// ErrSessionClosed is returned when operation is attempted on the session
+	// that is closing or already closed.
+	ErrSessionClosed = Error{Msg: "smpp: session closed"}
+	// ErrNotBound is returned when sending PDU that requires bound session
+	// before binding was completed.
+	ErrNotBound = Error{Msg: "smpp: session not bound", Temp: true}
+	// ErrSendingStopped is returned when sending requests after StopSending
+	// was called on the session.
+	ErrSendingStopped = Error{Msg: "smpp: sending stopped"}
+	// ErrRateLimited is returned by non-blocking send methods when sending
+	// would exceed SendRateLimit.
+	ErrRateLimited = Error{Msg: "smpp: send rate limit exceeded", Temp: true}
+)
+
 // SessionState describes session state.
 type SessionState int
 
@@ -73,6 +89,22 @@ const (
 	SMSC
 )
 
+// CloseReason describes why the session was closed.
+type CloseReason int
+
+const (
+	// CloseUnknown is reported while session is not closed yet.
+	CloseUnknown CloseReason = iota
+	// CloseLocal session was closed locally with Close, Drain or Unbind.
+	CloseLocal
+	// ClosePeerUnbind session was closed after peer requested unbind.
+	ClosePeerUnbind
+	// CloseError session was closed because of the connection or protocol error.
+	CloseError
+	// CloseTimeout session was closed because peer stopped responding.
+	CloseTimeout
+)
+
 // Logger provides logging interface for getting info about internals of smpp package.
 type Logger interface {
 	InfoF(msg string, params ...interface{})
@@ -142,6 +174,153 @@ type SessionConf struct {
 	Logger        Logger
 	Handler       Handler
 	Sequencer     pdu.Sequencer
+	// PermissiveTransitions delivers requests received in the wrong bound
+	// state to the handler instead of dropping them. Useful for peers that
+	// don't conform to the specification, like SMSCs sending deliver_sm to
+	// transmitter sessions.
+	PermissiveTransitions bool
+	// AutoRespondDeliver sends deliver_sm_resp automatically after the handler
+	// returns if handler didn't respond to deliver_sm request.
+	AutoRespondDeliver bool
+	// BindValidator is invoked for bind requests received by SMSC session
+	// before any state transition. If it returns false session responds
+	// with returned status and closes.
+	BindValidator func(ctx *Context) (pdu.Status, bool)
+	// HandlerConcurrency limits number of handlers running concurrently.
+	// Requests accepted into the request window above this limit wait for
+	// running handlers to finish. Zero means no limit besides ReqWinSize.
+	HandlerConcurrency int
+	// ReqWinHighWater is the soft limit of the request window. Once number
+	// of requests being handled reaches it, ReqWinHighWaterFraction of
+	// incoming requests are rejected with StatusThrottled, signaling peer
+	// to slow down before ReqWinSize is exceeded. Zero disables it.
+	ReqWinHighWater int
+	// ReqWinHighWaterFraction is the fraction of requests throttled above
+	// ReqWinHighWater, between 0 and 1. Defaults to 0.5.
+	ReqWinHighWaterFraction float64
+	// AdvertiseVersion is attached as sc_interface_version option to every
+	// bind response sent by the session if it's not already set.
+	AdvertiseVersion int
+	// AllowedSystemTypes lists system types that are allowed to bind to SMSC
+	// session. Binds with other system types are rejected with StatusInvSysTyp.
+	// Empty list allows all system types.
+	AllowedSystemTypes []string
+	// Profile validates outgoing PDUs against network rules before sending.
+	Profile pdu.Profile
+	// EnquireLinkInterval is the period of inactivity after which bound session
+	// sends enquire_link to the peer. Session is closed if peer doesn't respond
+	// within WindowTimeout. Applies to both ESME and SMSC sessions. Zero
+	// disables sending enquire_link.
+	EnquireLinkInterval time.Duration
+	// EnquireLinkRetries is the maximal number of enquire_link probes sent,
+	// including the first one, before peer is declared dead. Session is
+	// closed only if all probes fail, so transient network jitter is
+	// tolerated. Zero or one sends a single probe.
+	EnquireLinkRetries int
+	// EnquireLinkRetryDelay is the pause between failed enquire_link probe
+	// and the next retry.
+	EnquireLinkRetryDelay time.Duration
+	// MaxPDUSize limits the length of PDUs sent and received by the session.
+	// Sending or responding with larger PDU fails without writing anything
+	// while receiving one closes the session. Defaults to pdu.MaxPDUSize.
+	MaxPDUSize int
+	// AllowEmptyDestination permits sending submit_sm without destination_addr
+	// for SMSCs that resolve the destination themselves.
+	AllowEmptyDestination bool
+	// SendRateLimit limits number of requests per second written by Send,
+	// SendAsync, SendNoReply, WriteRaw and their variants. Send blocks until
+	// sending is allowed or context is done while the others fail with
+	// ErrRateLimited. Requests that fail before being written don't count
+	// towards the limit. Bursts of up to SendRateLimit requests are allowed.
+	// Zero means no limit.
+	SendRateLimit int
+	// ReadBufferSize sets size of the buffer used for reading from the
+	// connection. Defaults to pdu.DefaultDecodeBufferSize.
+	ReadBufferSize int
+	// BufferPool provides buffers for decoding incoming PDUs. Server shares
+	// the pool from its template configuration between all sessions.
+	BufferPool *pdu.BufferPool
+	// EchoGenericNack echoes command_id and sequence_number of the rejected
+	// PDU in the body of generic_nack sent by the session. Specification
+	// defines generic_nack without body so enable it only for interop with
+	// peers expecting it.
+	EchoGenericNack bool
+	// OnOutbind is invoked instead of the Handler when ESME session receives
+	// outbind. Use AutoBindReceiverOnOutbind to bind receiver automatically.
+	OnOutbind func(ctx *Context)
+	// OnUnmatchedResponse is invoked when received response doesn't match
+	// any outstanding request, like late responses to canceled requests or
+	// duplicates. Such responses are dropped after the hook returns.
+	OnUnmatchedResponse func(h pdu.Header, p pdu.PDU)
+	// SequentialHandling invokes the handler inline in the receiving loop so
+	// requests are handled one at a time in order of arrival. No PDUs are
+	// read while handler runs so handler must not wait for responses to
+	// requests sent through the same session.
+	SequentialHandling bool
+	// BindResponder produces responses to bind requests received by SMSC
+	// session instead of the Handler, so handler deals only with message
+	// PDUs. If it returns nil response, bind response carrying SystemID
+	// from this configuration is sent with returned status. Session stays
+	// open after rejected bind so peer can try binding again.
+	BindResponder func(req pdu.PDU) (resp pdu.PDU, status pdu.Status)
+	// LenientDecoding tolerates C-Octet strings in received submit_sm and
+	// deliver_sm longer than allowed by the specification instead of
+	// rejecting the PDU.
+	LenientDecoding bool
+	// DisableStateMachine stops enforcing session states so any PDU can be
+	// sent or received in any state before the session is closed. Valid
+	// transitions still update the state, invalid ones are only logged.
+	// It's unsafe and meant for testing and for peers that can't be handled
+	// with PermissiveTransitions.
+	DisableStateMachine bool
+	// Metrics receives session events for collecting metrics. Server shares
+	// it from its template configuration between all sessions.
+	Metrics Metrics
+}
+
+// Metrics receives events emitted by sessions. Methods are called
+// synchronously from session goroutines, often while holding session lock,
+// so they must be fast and safe for concurrent use. Package metrics provides
+// implementation which can be bridged to monitoring systems.
+type Metrics interface {
+	// SessionOpened is called when session is created.
+	SessionOpened()
+	// SessionBound is called when session becomes bound in given state.
+	SessionBound(state SessionState)
+	// SessionClosed is called when session is closed.
+	SessionClosed()
+	// PDUSent is called for every PDU written to the connection.
+	PDUSent(id pdu.CommandID)
+	// PDUReceived is called for every PDU read from the connection.
+	PDUReceived(id pdu.CommandID)
+	// Error is called when reading, decoding or encoding of PDU fails.
+	Error(err error)
+	// Throttled is called when incoming request is rejected because
+	// request window is full.
+	Throttled()
+	// WindowChanged reports change of the number of outstanding sent
+	// requests and received requests being handled.
+	WindowChanged(sent, received int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) SessionOpened()                   {}
+func (noopMetrics) SessionBound(SessionState)        {}
+func (noopMetrics) SessionClosed()                   {}
+func (noopMetrics) PDUSent(pdu.CommandID)            {}
+func (noopMetrics) PDUReceived(pdu.CommandID)        {}
+func (noopMetrics) Error(error)                      {}
+func (noopMetrics) Throttled()                       {}
+func (noopMetrics) WindowChanged(sent, received int) {}
+
+// pduDump defers rendering of the PDU until it's actually logged.
+type pduDump struct {
+	p pdu.PDU
+}
+
+func (d pduDump) String() string {
+	return pdu.Dump(d.p)
 }
 
 type response struct {
@@ -150,6 +329,12 @@ type response struct {
 }
 
 // Session is the engine that coordinates SMPP protocol for bounded peers.
+//
+// Bind that session isn't allowed to accept is rejected with StatusAlyBnd.
+// That covers bind collision, when both ESME ends of the relay try to bind
+// at the same time, and binding already bound SMSC session. Session that
+// receives bind response with error status returns to the open state so
+// binding can be retried.
 type Session struct {
 	conf     *SessionConf
 	rwc      io.ReadWriteCloser
@@ -163,6 +348,20 @@ type Session struct {
 	state    SessionState
 	systemID string
 	closed   chan struct{}
+	drained  chan struct{}
+	err      error
+	handlers chan struct{}
+	lastRecv time.Time
+	limiter  *rateLimiter
+	boundAt  time.Time
+	reason   CloseReason
+	stopped  bool
+	read     *countingReader
+	written  *countingWriter
+	// highWater accumulates ReqWinHighWaterFraction for requests received
+	// above the high-water mark, request is throttled each time it
+	// reaches one.
+	highWater float64
 }
 
 // NewSession creates new SMPP session and starts goroutine for listening incoming
@@ -186,22 +385,106 @@ func NewSession(rwc io.ReadWriteCloser, conf SessionConf) *Session {
 	if conf.ReqWinSize == 0 {
 		conf.ReqWinSize = 10
 	}
+	if conf.ReqWinHighWater > 0 && conf.ReqWinHighWaterFraction == 0 {
+		conf.ReqWinHighWaterFraction = 0.5
+	}
 	if conf.ID == "" {
 		conf.ID = genSessionID()
 	}
+	if conf.MaxPDUSize == 0 {
+		conf.MaxPDUSize = pdu.MaxPDUSize
+	}
+	if conf.Metrics == nil {
+		conf.Metrics = noopMetrics{}
+	}
+	if conf.Sequencer == nil {
+		conf.Sequencer = pdu.NewSequencer(1)
+	}
+	read := &countingReader{r: rwc}
+	written := &countingWriter{w: rwc}
 	sess := &Session{
-		conf:   &conf,
-		rwc:    rwc,
-		enc:    pdu.NewEncoder(rwc, conf.Sequencer),
-		dec:    pdu.NewDecoder(rwc),
-		sent:   make(map[uint32]chan response, conf.SendWinSize),
-		closed: make(chan struct{}),
+		conf:     &conf,
+		rwc:      rwc,
+		enc:      pdu.NewEncoder(written, conf.Sequencer),
+		dec:      newDecoder(read, &conf),
+		sent:     make(map[uint32]chan response, conf.SendWinSize),
+		closed:   make(chan struct{}),
+		lastRecv: time.Now(),
+		read:     read,
+		written:  written,
+	}
+	// Encoder enforces MaxPDUSize on every PDU sent by the session.
+	sess.enc.SetMaxSize(conf.MaxPDUSize)
+	if conf.HandlerConcurrency > 0 {
+		sess.handlers = make(chan struct{}, conf.HandlerConcurrency)
+	}
+	if conf.SendRateLimit > 0 {
+		sess.limiter = newRateLimiter(conf.SendRateLimit)
 	}
+	conf.Metrics.SessionOpened()
 	sess.wg.Add(1)
 	go sess.serve()
+	if conf.EnquireLinkInterval > 0 {
+		go sess.keepalive()
+	}
 	return sess
 }
 
+func newDecoder(r io.Reader, conf *SessionConf) *pdu.Decoder {
+	opts := []pdu.DecoderOption{pdu.DecodeMaxSize(conf.MaxPDUSize)}
+	if conf.ReadBufferSize > 0 {
+		opts = append(opts, pdu.DecodeBufferSize(conf.ReadBufferSize))
+	}
+	if conf.BufferPool != nil {
+		opts = append(opts, pdu.DecodePool(conf.BufferPool))
+	}
+	if conf.LenientDecoding {
+		opts = append(opts, pdu.DecodeLenient())
+	}
+	return pdu.NewDecoder(r, opts...)
+}
+
+// SessionStats holds counters of the session traffic.
+type SessionStats struct {
+	// BytesRead is the number of bytes read from the connection.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written to the connection.
+	BytesWritten uint64
+}
+
+// Stats returns current traffic counters of the session. It's safe to call
+// it concurrently with session usage.
+func (sess *Session) Stats() SessionStats {
+	return SessionStats{
+		BytesRead:    atomic.LoadUint64(&sess.read.n),
+		BytesWritten: atomic.LoadUint64(&sess.written.n),
+	}
+}
+
+// countingReader counts bytes read from the underlying reader.
+type countingReader struct {
+	n uint64
+	r io.Reader
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	atomic.AddUint64(&c.n, uint64(n))
+	return n, err
+}
+
+// countingWriter counts bytes written to the underlying writer.
+type countingWriter struct {
+	n uint64
+	w io.Writer
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	atomic.AddUint64(&c.n, uint64(n))
+	return n, err
+}
+
 // ID uniquely identifies the session.
 func (sess *Session) ID() string {
 	return sess.conf.ID
@@ -218,10 +501,50 @@ func (sess *Session) SystemID() string {
 	return "-"
 }
 
+// PeerSystemID returns system_id reported by the peer during binding, either in
+// bind request on SMSC or in bind response on ESME. Empty string is returned
+// if peer didn't report one yet.
+func (sess *Session) PeerSystemID() string {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.systemID
+}
+
+// State returns current session state.
+func (sess *Session) State() SessionState {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.state
+}
+
+// CanSubmit reports whether session is bound as transmitter or transceiver
+// and sending wasn't stopped with StopSending.
+func (sess *Session) CanSubmit() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return !sess.stopped && (sess.state == StateBoundTx || sess.state == StateBoundTRx)
+}
+
+// CanReceive reports whether session is bound as receiver or transceiver.
+func (sess *Session) CanReceive() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.state == StateBoundRx || sess.state == StateBoundTRx
+}
+
 func (sess *Session) String() string {
 	return fmt.Sprintf("(%s:%s:%s)", sess.conf.Type, sess.SystemID(), sess.conf.ID)
 }
 
+// Conn returns underlying network connection for advanced tuning like
+// setting socket options. It returns nil if session isn't running over
+// net.Conn. Reading from or writing to the returned connection will
+// corrupt the session.
+func (sess *Session) Conn() net.Conn {
+	conn, _ := sess.rwc.(net.Conn)
+	return conn
+}
+
 func (sess *Session) remoteAddr() string {
 	if ra, ok := sess.rwc.(RemoteAddresser); ok {
 		return ra.RemoteAddr().String()
@@ -237,30 +560,87 @@ func (sess *Session) serve() {
 	defer cancel()
 	for {
 		h, p, err := sess.dec.Decode()
+		if errors.Is(err, pdu.ErrBodyDecode) {
+			sess.conf.Logger.ErrorF("decoding pdu body: %s %s %+v", sess, h.CommandID(), err)
+			sess.conf.Metrics.Error(err)
+			sess.rejectMalformed(h, err)
+			continue
+		}
 		if err != nil {
 			if err == io.EOF {
 				sess.conf.Logger.InfoF("decoding pdu: %s %+v", sess, err)
 			} else {
 				sess.conf.Logger.ErrorF("decoding pdu: %s %+v", sess, err)
+				sess.conf.Metrics.Error(err)
+			}
+			sess.mu.Lock()
+			if sess.state != StateClosing && sess.state != StateClosed {
+				sess.err = err
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					sess.setCloseReason(CloseTimeout)
+				} else {
+					sess.setCloseReason(CloseError)
+				}
 			}
+			sess.mu.Unlock()
+			sess.shutdown()
+			return
+		}
+		sess.conf.Metrics.PDUReceived(h.CommandID())
+		if !sess.validateBind(ctx, h, p) {
 			sess.shutdown()
 			return
 		}
 		sess.mu.Lock()
-		sess.systemID = pdu.SystemID(p)
-		if err := sess.makeTransition(h.CommandID(), true); err != nil {
-			sess.conf.Logger.ErrorF("transitioning upon receive: %s %+v", sess, err)
-			sess.mu.Unlock()
-			continue
+		sess.lastRecv = time.Now()
+		if id := pdu.SystemID(p); id != "" {
+			sess.systemID = id
+		}
+		if isBindResp(h.CommandID()) && h.Status() != pdu.StatusOK && sess.state == StateBinding {
+			// Rejected bind leaves the session open for another attempt.
+			if err := sess.setState(StateOpen); err != nil {
+				sess.conf.Logger.ErrorF("transitioning upon receive: %s %+v", sess, err)
+			}
+		} else if err := sess.makeTransition(h.CommandID(), true); err != nil {
+			if isBind(h.CommandID()) {
+				// Bind collided with our own bind or session is already
+				// bound.
+				sess.conf.Logger.ErrorF("rejecting bind: %s %+v", sess, err)
+				sess.rejectBind(h, p)
+				sess.mu.Unlock()
+				continue
+			}
+			if !sess.permitTransition(h.CommandID()) {
+				sess.conf.Logger.ErrorF("transitioning upon receive: %s %+v", sess, err)
+				sess.mu.Unlock()
+				continue
+			}
+			sess.conf.Logger.ErrorF("permitting invalid transition: %s %+v", sess, err)
 		}
 		// Handle PDU requests.
 		if pdu.IsRequest(h.CommandID()) {
-			sess.conf.Logger.InfoF("received request: %s %s%+v", sess, p.CommandID(), p)
-			if sess.reqCount == sess.conf.ReqWinSize {
-				sess.throttle(h.Sequence())
+			if h.CommandID() == pdu.UnbindID {
+				sess.setCloseReason(ClosePeerUnbind)
+			}
+			sess.conf.Logger.InfoF("received request: %s %s", sess, pduDump{p})
+			if sess.conf.Type == SMSC && sess.conf.BindResponder != nil && isBind(h.CommandID()) {
+				sess.mu.Unlock()
+				sess.respondBind(h, p)
+				continue
+			}
+			if sess.reqCount == sess.conf.ReqWinSize || sess.aboveHighWater() {
+				sess.conf.Metrics.Throttled()
+				sess.nack(h, pdu.StatusThrottled)
 			} else {
 				sess.wg.Add(1)
 				sess.reqCount++
+				sess.conf.Metrics.WindowChanged(0, 1)
+				if sess.conf.SequentialHandling {
+					sess.mu.Unlock()
+					sess.handleRequest(ctx, h, p)
+					continue
+				}
 				go sess.handleRequest(ctx, h, p)
 			}
 			sess.mu.Unlock()
@@ -268,49 +648,348 @@ func (sess *Session) serve() {
 		}
 		// Handle PDU responses.
 		if l, ok := sess.sent[h.Sequence()]; ok {
-			sess.conf.Logger.InfoF("received response: %s %s%+v", sess, p.CommandID(), p)
-			delete(sess.sent, h.Sequence())
+			sess.conf.Logger.InfoF("received response: %s %s", sess, pduDump{p})
+			sess.deleteSent(h.Sequence())
 			sess.mu.Unlock()
 
 			l <- response{
 				resp: p,
-				err:  toError(h.Status()),
+				err:  responseError(h),
 			}
 			continue
 		}
-		sess.conf.Logger.ErrorF("unexpected response: %s %s%+v", sess, p.CommandID(), p)
+		if p == nil {
+			sess.conf.Logger.ErrorF("unexpected response: %s %s", sess, h.CommandID())
+			sess.mu.Unlock()
+			continue
+		}
+		sess.conf.Logger.ErrorF("unexpected response: %s %s", sess, pduDump{p})
 		sess.mu.Unlock()
+		if hook := sess.conf.OnUnmatchedResponse; hook != nil {
+			hook(h, p)
+		}
 	}
 }
 
-func (sess *Session) throttle(seq uint32) {
-	resp := pdu.GenericNack{}
-	if _, err := sess.enc.Encode(resp, pdu.EncodeStatus(pdu.StatusThrottled), pdu.EncodeSeq(seq)); err != nil {
+// keepalive sends enquire_link to the peer when nothing was received for
+// EnquireLinkInterval and closes the session if the peer doesn't respond
+// to any of the EnquireLinkRetries probes. Probes that couldn't be sent
+// because of temporary local errors are skipped until the next interval.
+func (sess *Session) keepalive() {
+	t := time.NewTicker(sess.conf.EnquireLinkInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-sess.closed:
+			return
+		case <-t.C:
+		}
+		sess.mu.Lock()
+		idle := time.Since(sess.lastRecv)
+		bound := sess.state == StateBoundTx || sess.state == StateBoundRx || sess.state == StateBoundTRx
+		sess.mu.Unlock()
+		if !bound || idle < sess.conf.EnquireLinkInterval {
+			continue
+		}
+		err := sess.probe()
+		for i := 1; err != nil && !errors.Is(err, ErrSessionClosed) && !localError(err) && i < sess.conf.EnquireLinkRetries; i++ {
+			sess.conf.Logger.InfoF("retrying enquire_link: %s %+v", sess, err)
+			select {
+			case <-sess.closed:
+				return
+			case <-time.After(sess.conf.EnquireLinkRetryDelay):
+			}
+			err = sess.probe()
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrSessionClosed) {
+			return
+		}
+		if localError(err) {
+			// Probe wasn't sent so it says nothing about the peer.
+			sess.conf.Logger.InfoF("skipping enquire_link: %s %+v", sess, err)
+			continue
+		}
+		sess.conf.Logger.ErrorF("peer not responding to enquire_link: %s %+v", sess, err)
+		sess.mu.Lock()
+		if sess.state != StateClosing && sess.state != StateClosed {
+			sess.err = err
+			sess.setCloseReason(CloseTimeout)
+		}
+		sess.mu.Unlock()
+		sess.Close()
+		return
+	}
+}
+
+// localError reports if err is temporary session error, like closed sending
+// window, that prevented the probe from being sent.
+func localError(err error) bool {
+	var e Error
+	return errors.As(err, &e) && e.Temp
+}
+
+// probe pings the peer waiting for the response up to WindowTimeout.
+func (sess *Session) probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), sess.conf.WindowTimeout)
+	defer cancel()
+	return sess.Ping(ctx)
+}
+
+// validateBind checks bind requests received by open SMSC session against
+// AllowedSystemTypes and BindValidator. If bind is rejected it responds
+// with the rejection status.
+func (sess *Session) validateBind(ctx context.Context, h pdu.Header, req pdu.PDU) bool {
+	if sess.conf.Type != SMSC {
+		return true
+	}
+	if len(sess.conf.AllowedSystemTypes) == 0 && sess.conf.BindValidator == nil {
+		return true
+	}
+	resp := bindResponse(req, sess.conf.SystemID)
+	if resp == nil {
+		return true
+	}
+	sess.mu.Lock()
+	open := sess.state == StateOpen || sess.conf.DisableStateMachine
+	sess.mu.Unlock()
+	if !open {
+		// Bind is rejected with StatusAlyBnd upon transition.
+		return true
+	}
+	status, ok := sess.checkBind(ctx, h, req)
+	if ok {
+		return true
+	}
+	sess.advertiseVersion(resp)
+	sess.conf.Logger.ErrorF("bind rejected: %s %s", sess, status)
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if _, err := sess.encode(resp, pdu.EncodeStatus(status), pdu.EncodeSeq(h.Sequence())); err != nil {
+		sess.conf.Logger.ErrorF("error encoding pdu: %s %+v", sess, err)
+	}
+	return false
+}
+
+func (sess *Session) checkBind(ctx context.Context, h pdu.Header, req pdu.PDU) (pdu.Status, bool) {
+	if len(sess.conf.AllowedSystemTypes) > 0 {
+		allowed := false
+		systemType := pdu.SystemType(req)
+		for _, st := range sess.conf.AllowedSystemTypes {
+			if st == systemType {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return pdu.StatusInvSysTyp, false
+		}
+	}
+	if sess.conf.BindValidator == nil {
+		return pdu.StatusOK, true
+	}
+	return sess.conf.BindValidator(&Context{
+		sess: sess,
+		ctx:  ctx,
+		seq:  h.Sequence(),
+		req:  req,
+	})
+}
+
+// respondBind responds to bind request using configured BindResponder.
+// Rejected bind returns session to the open state.
+func (sess *Session) respondBind(h pdu.Header, req pdu.PDU) {
+	resp, status := sess.conf.BindResponder(req)
+	if resp == nil {
+		resp = bindResponse(req, sess.conf.SystemID)
+	}
+	sess.advertiseVersion(resp)
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	var err error
+	if status == pdu.StatusOK {
+		err = sess.makeTransition(resp.CommandID(), false)
+	} else {
+		sess.conf.Logger.ErrorF("bind rejected: %s %s", sess, status)
+		err = sess.setState(StateOpen)
+	}
+	if err != nil {
+		sess.conf.Logger.ErrorF("transitioning resp pdu: %s %+v", sess, err)
+		return
+	}
+	if _, err := sess.encode(resp, pdu.EncodeStatus(status), pdu.EncodeSeq(h.Sequence())); err != nil {
 		sess.conf.Logger.ErrorF("error encoding pdu: %s %+v", sess, err)
 		return
 	}
+	sess.conf.Logger.InfoF("sent response: %s %s", sess, pduDump{resp})
+}
+
+func isBind(id pdu.CommandID) bool {
+	switch id {
+	case pdu.BindTransceiverID, pdu.BindTransmitterID, pdu.BindReceiverID:
+		return true
+	}
+	return false
+}
+
+func isBindResp(id pdu.CommandID) bool {
+	switch id {
+	case pdu.BindTransceiverRespID, pdu.BindTransmitterRespID, pdu.BindReceiverRespID:
+		return true
+	}
+	return false
+}
+
+// rejectBind responds to bind received in the state which doesn't allow
+// binding with StatusAlyBnd.
+// Must be guarded by mutex.
+func (sess *Session) rejectBind(h pdu.Header, req pdu.PDU) {
+	resp := bindResponse(req, sess.conf.SystemID)
+	if _, err := sess.encode(resp, pdu.EncodeStatus(pdu.StatusAlyBnd), pdu.EncodeSeq(h.Sequence())); err != nil {
+		sess.conf.Logger.ErrorF("error encoding pdu: %s %+v", sess, err)
+	}
+}
+
+// bindResponse creates response matching bind request or returns nil
+// if req is not bind request.
+func bindResponse(req pdu.PDU, sysID string) pdu.PDU {
+	switch p := req.(type) {
+	case *pdu.BindTRx:
+		return p.Response(sysID)
+	case *pdu.BindTx:
+		return p.Response(sysID)
+	case *pdu.BindRx:
+		return p.Response(sysID)
+	}
+	return nil
+}
+
+// advertiseVersion sets sc_interface_version option on bind responses
+// if session is configured with AdvertiseVersion.
+func (sess *Session) advertiseVersion(resp pdu.PDU) {
+	if sess.conf.AdvertiseVersion == 0 {
+		return
+	}
+	var opts **pdu.Options
+	switch p := resp.(type) {
+	case *pdu.BindTRxResp:
+		opts = &p.Options
+	case *pdu.BindTxResp:
+		opts = &p.Options
+	case *pdu.BindRxResp:
+		opts = &p.Options
+	default:
+		return
+	}
+	if *opts == nil {
+		*opts = pdu.NewOptions()
+	}
+	if _, ok := (*opts).GetSingle(pdu.TagScInterfaceVersion); !ok {
+		(*opts).SetScInterfaceVersion(sess.conf.AdvertiseVersion)
+	}
+}
+
+// rejectMalformed responds with generic_nack to the request whose body couldn't
+// be decoded or fails the outstanding request if it's the response. PDUs with
+// unknown command_id are rejected with StatusInvCmdID.
+func (sess *Session) rejectMalformed(h pdu.Header, err error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if errors.Is(err, pdu.ErrUnknownCommand) {
+		sess.nack(h, pdu.StatusInvCmdID)
+		return
+	}
+	if pdu.IsRequest(h.CommandID()) {
+		sess.nack(h, pdu.StatusSysErr)
+		return
+	}
+	if l, ok := sess.sent[h.Sequence()]; ok {
+		sess.deleteSent(h.Sequence())
+		l <- response{err: err}
+	}
+}
+
+// aboveHighWater reports if request should be throttled because request
+// window is filled above ReqWinHighWater.
+//
+// Must be guarded by mutex.
+func (sess *Session) aboveHighWater() bool {
+	if sess.conf.ReqWinHighWater <= 0 || sess.reqCount < sess.conf.ReqWinHighWater {
+		sess.highWater = 0
+		return false
+	}
+	sess.highWater += sess.conf.ReqWinHighWaterFraction
+	if sess.highWater < 1 {
+		return false
+	}
+	sess.highWater--
+	return true
+}
+
+// Must be guarded by mutex.
+func (sess *Session) nack(h pdu.Header, status pdu.Status) {
+	resp := &pdu.GenericNack{}
+	if sess.conf.EchoGenericNack {
+		resp.OriginalCommandID = h.CommandID()
+		resp.OriginalSequence = h.Sequence()
+	}
+	if _, err := sess.encode(resp, pdu.EncodeStatus(status), pdu.EncodeSeq(h.Sequence())); err != nil {
+		sess.conf.Logger.ErrorF("error encoding pdu: %s %+v", sess, err)
+	}
 }
 
 func (sess *Session) handleRequest(ctx context.Context, h pdu.Header, req pdu.PDU) {
-	ctx, cancel := context.WithTimeout(ctx, sess.conf.WindowTimeout)
-	defer func() {
-		cancel()
+	var release func()
+	done := func() {
+		if release != nil {
+			release()
+		}
 		sess.mu.Lock()
 		sess.reqCount--
+		sess.conf.Metrics.WindowChanged(0, -1)
 		sess.mu.Unlock()
 		sess.wg.Done()
-	}()
+	}
+	if sess.handlers != nil {
+		select {
+		case sess.handlers <- struct{}{}:
+			release = func() { <-sess.handlers }
+		case <-ctx.Done():
+			done()
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, sess.conf.WindowTimeout)
 	sessCtx := &Context{
-		sess: sess,
-		ctx:  ctx,
-		seq:  h.Sequence(),
-		req:  req,
+		sess:      sess,
+		ctx:       ctx,
+		seq:       h.Sequence(),
+		req:       req,
+		reqStatus: h.Status(),
 	}
-	sess.conf.Handler.ServeSMPP(sessCtx)
-
-	if sessCtx.close {
-		sess.shutdown()
+	sessCtx.finish = func() {
+		cancel()
+		if sessCtx.close {
+			sess.shutdown()
+		}
+		done()
+	}
+	if req.CommandID() == pdu.OutbindID && sess.conf.OnOutbind != nil {
+		sess.conf.OnOutbind(sessCtx)
+	} else {
+		sess.conf.Handler.ServeSMPP(sessCtx)
 	}
+	if sessCtx.hijacked {
+		return
+	}
+	if sess.conf.AutoRespondDeliver && req.CommandID() == pdu.DeliverSmID && sessCtx.resp == nil {
+		if err := sessCtx.Respond(&pdu.DeliverSmResp{}, pdu.StatusOK); err != nil {
+			sess.conf.Logger.ErrorF("auto responding to deliver_sm: %s %+v", sess, err)
+		}
+	}
+	sessCtx.finish()
 }
 
 func (sess *Session) shutdown() {
@@ -321,9 +1000,20 @@ func (sess *Session) shutdown() {
 // It gracefully waits for all handlers to finish execution before returning.
 func (sess *Session) Close() error {
 	sess.mu.Lock()
-	if err := sess.setState(StateClosing); err != nil {
-		sess.mu.Unlock()
-		return err
+	switch sess.state {
+	case StateOpen, StateBinding:
+		// Session that isn't bound has nothing to unbind so it bypasses
+		// the transition table to release the connection.
+		sess.enterState(StateClosing)
+	default:
+		if err := sess.setState(StateClosing); err != nil {
+			sess.mu.Unlock()
+			return err
+		}
+	}
+	sess.setCloseReason(CloseLocal)
+	if n := len(sess.sent); n > 0 {
+		sess.conf.Metrics.WindowChanged(-n, 0)
 	}
 	for k, l := range sess.sent {
 		delete(sess.sent, k)
@@ -335,12 +1025,79 @@ func (sess *Session) Close() error {
 		return err
 	}
 	sess.mu.Unlock()
+	sess.conf.Metrics.SessionClosed()
 	sess.wg.Wait()
 	sess.conf.Logger.InfoF("session closed: %s", sess)
 	close(sess.closed)
 	return nil
 }
 
+// StopSending rejects sending of new requests with ErrSendingStopped while
+// session keeps receiving and handling incoming requests until it's closed
+// or unbound. Unbind and enquire_link can still be sent so the session can
+// be kept alive and terminated gracefully.
+func (sess *Session) StopSending() {
+	sess.mu.Lock()
+	sess.stopped = true
+	sess.mu.Unlock()
+}
+
+// Drain stops accepting new requests for sending and waits for responses to
+// all outstanding requests before closing the session. If context is done
+// before all responses are received the session is closed anyway and context
+// error is returned. If session is closed during draining, e.g. peer drops
+// the connection, ErrSessionClosed is returned.
+func (sess *Session) Drain(ctx context.Context) error {
+	sess.mu.Lock()
+	if sess.drained == nil {
+		sess.drained = make(chan struct{})
+		if len(sess.sent) == 0 {
+			close(sess.drained)
+		}
+	}
+	drained := sess.drained
+	sess.mu.Unlock()
+	select {
+	case <-drained:
+		return sess.Close()
+	case <-sess.closed:
+		return ErrSessionClosed
+	case <-ctx.Done():
+		sess.Close()
+		return ctx.Err()
+	}
+}
+
+// encode writes PDU to the connection and reports it to metrics.
+func (sess *Session) encode(p pdu.PDU, opts ...pdu.EncoderOption) (uint32, error) {
+	if sess.conf.AllowEmptyDestination {
+		opts = append(opts, pdu.EncodeAllowEmptyDestination())
+	}
+	seq, err := sess.enc.Encode(p, opts...)
+	if err != nil {
+		sess.conf.Metrics.Error(err)
+		return seq, err
+	}
+	sess.conf.Metrics.PDUSent(p.CommandID())
+	return seq, nil
+}
+
+// deleteSent removes request from the sending window and notifies Drain
+// once there are no more outstanding requests.
+//
+// Must be guarded by mutex.
+func (sess *Session) deleteSent(seq uint32) {
+	delete(sess.sent, seq)
+	sess.conf.Metrics.WindowChanged(-1, 0)
+	if sess.drained != nil && len(sess.sent) == 0 {
+		select {
+		case <-sess.drained:
+		default:
+			close(sess.drained)
+		}
+	}
+}
+
 // Must be guarded by mutex.
 func (sess *Session) setState(state SessionState) error {
 	if sess.state == state {
@@ -374,52 +1131,283 @@ func (sess *Session) setState(state SessionState) error {
 	case StateClosed:
 		return fmt.Errorf("smpp: session %s already in closed state %s", sess, state)
 	}
+	sess.enterState(state)
+	return nil
+}
+
+// Must be guarded by mutex.
+func (sess *Session) enterState(state SessionState) {
 	sess.state = state
+	switch state {
+	case StateBoundRx, StateBoundTRx, StateBoundTx:
+		sess.boundAt = time.Now()
+		sess.conf.Metrics.SessionBound(state)
+	}
 	if hook := sess.conf.SessionState; hook != nil {
 		hook(sess.conf.ID, sess.SystemID(), sess.state)
 	}
-	return nil
 }
 
 // Send writes PDU to the bounded connection effectively sending it to the peer.
 // Use context deadline to specify how much you would like to wait for the response.
+// Sending is paced according to SendRateLimit.
 func (sess *Session) Send(ctx context.Context, req pdu.PDU) (pdu.PDU, error) {
+	return sess.send(ctx, req, 0)
+}
+
+// SendSeq is like Send but sends request with externally managed sequence
+// number instead of the one provided by the session Sequencer. It's
+// intended for proxies that rewrite sequence numbers of multiplexed
+// sessions. Caller is responsible for avoiding collisions with sequence
+// numbers generated by the Sequencer.
+func (sess *Session) SendSeq(ctx context.Context, req pdu.PDU, seq uint32) (pdu.PDU, error) {
+	if seq == 0 {
+		return nil, Error{Msg: "smpp: sending with zero sequence number"}
+	}
+	return sess.send(ctx, req, seq)
+}
+
+func (sess *Session) send(ctx context.Context, req pdu.PDU, seq uint32) (pdu.PDU, error) {
+	reserved := false
+	if sess.limiter != nil {
+		if err := sess.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		reserved = true
+	}
+	call, err := sess.sendAsync(req, seq, reserved)
+	if err != nil {
+		return nil, err
+	}
+	return call.Wait(ctx)
+}
+
+// Ping sends enquire_link to the peer and waits for the response.
+// It returns nil if peer responded successfully before context is done.
+func (sess *Session) Ping(ctx context.Context) error {
+	resp, err := sess.Send(ctx, &pdu.EnquireLink{})
+	if err != nil {
+		return err
+	}
+	if resp.CommandID() != pdu.EnquireLinkRespID {
+		return Error{Msg: fmt.Sprintf("smpp: unexpected response to enquire_link %s", resp.CommandID())}
+	}
+	return nil
+}
+
+// SendNoReply writes request pdu to the bounded peer without waiting for
+// the response. Request doesn't take place in the sending window so any
+// response to it is dropped as unmatched. It's meant for PDUs without
+// response like alert_notification, outbind or generic_nack.
+func (sess *Session) SendNoReply(req pdu.PDU) error {
+	if req == nil {
+		return Error{Msg: "smpp: sending nil pdu"}
+	}
+	if err := sess.conf.Profile.Validate(req); err != nil {
+		return err
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.drained != nil {
+		return ErrSessionClosed
+	}
+	if sess.stopped && req.CommandID() != pdu.UnbindID && req.CommandID() != pdu.EnquireLinkID {
+		return ErrSendingStopped
+	}
+	if !sess.takeToken() {
+		return ErrRateLimited
+	}
+	if err := sess.makeTransition(req.CommandID(), false); err != nil {
+		sess.putToken()
+		sess.conf.Logger.ErrorF("transitioning before send: %s %+v", sess, err)
+		return err
+	}
+	if _, err := sess.encode(req); err != nil {
+		sess.putToken()
+		return err
+	}
+	sess.conf.Logger.InfoF("request sent: %s %s", sess, pduDump{req})
+	return nil
+}
+
+// WriteRaw writes already encoded PDU frame to the connection under the
+// session lock without re-encoding it. Frame header is validated and its
+// command_id goes through the same state transition checks as PDUs sent
+// with Send. Caller owns sequence numbers of the written frames and any
+// responses to requests written this way are dropped as unmatched.
+func (sess *Session) WriteRaw(frame []byte) error {
+	if len(frame) < 16 {
+		return Error{Msg: fmt.Sprintf("smpp: raw frame length %d shorter than header", len(frame))}
+	}
+	h := pdu.NewHeader(0, 0, 0)
+	if err := h.UnmarshalBinary(frame[:16]); err != nil {
+		return err
+	}
+	if int(h.Length()) != len(frame) {
+		return Error{Msg: fmt.Sprintf("smpp: raw frame length %d doesn't match command_length %d", len(frame), h.Length())}
+	}
+	if len(frame) > sess.conf.MaxPDUSize {
+		return Error{Msg: fmt.Sprintf("smpp: raw frame length %d exceeds maximum pdu size %d", len(frame), sess.conf.MaxPDUSize)}
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if !sess.takeToken() {
+		return ErrRateLimited
+	}
+	if err := sess.makeTransition(h.CommandID(), false); err != nil {
+		sess.putToken()
+		sess.conf.Logger.ErrorF("transitioning before raw write: %s %+v", sess, err)
+		return err
+	}
+	if _, err := sess.written.Write(frame); err != nil {
+		sess.conf.Metrics.Error(err)
+		return err
+	}
+	sess.conf.Metrics.PDUSent(h.CommandID())
+	sess.conf.Logger.InfoF("raw frame written: %s %s %d", sess, h.CommandID(), h.Sequence())
+	return nil
+}
+
+// SendAsync writes PDU to the bounded connection without waiting for the response.
+// Returned Call must be used to wait for the response or to cancel it.
+func (sess *Session) SendAsync(req pdu.PDU) (*Call, error) {
+	return sess.sendAsync(req, 0, false)
+}
+
+// SendAsyncSeq is like SendAsync but uses provided sequence number.
+// See SendSeq for details.
+func (sess *Session) SendAsyncSeq(req pdu.PDU, seq uint32) (*Call, error) {
+	if seq == 0 {
+		return nil, Error{Msg: "smpp: sending with zero sequence number"}
+	}
+	return sess.sendAsync(req, seq, false)
+}
+
+// takeToken takes send token from the rate limiter without blocking.
+func (sess *Session) takeToken() bool {
+	return sess.limiter == nil || sess.limiter.take()
+}
+
+// putToken returns send token taken for the request that wasn't written.
+func (sess *Session) putToken() {
+	if sess.limiter != nil {
+		sess.limiter.put()
+	}
+}
+
+// sendAsync sends request using sequence number from Sequencer if seq is 0.
+// If reserved is true caller already took the send token, otherwise it's
+// taken without blocking once request passes the checks. Token is returned
+// if request isn't written.
+func (sess *Session) sendAsync(req pdu.PDU, seq uint32, reserved bool) (*Call, error) {
+	written := false
+	defer func() {
+		if reserved && !written {
+			sess.putToken()
+		}
+	}()
 	if req == nil {
 		return nil, Error{Msg: "smpp: sending nil pdu"}
 	}
+	if err := sess.conf.Profile.Validate(req); err != nil {
+		return nil, err
+	}
 	sess.mu.Lock()
+	if sess.drained != nil {
+		sess.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if sess.stopped && req.CommandID() != pdu.UnbindID && req.CommandID() != pdu.EnquireLinkID {
+		sess.mu.Unlock()
+		return nil, ErrSendingStopped
+	}
 	if len(sess.sent) == sess.conf.SendWinSize {
 		sess.mu.Unlock()
 		return nil, Error{Msg: "smpp: sending window closed", Temp: true}
 	}
+	if !reserved {
+		if !sess.takeToken() {
+			sess.mu.Unlock()
+			return nil, ErrRateLimited
+		}
+		reserved = true
+	}
+	if seq == 0 {
+		// Sequence is drawn here instead of in encoder so it can be checked
+		// against the ones provided to SendSeq.
+		seq = sess.conf.Sequencer.Next()
+	}
+	if _, ok := sess.sent[seq]; ok {
+		sess.mu.Unlock()
+		return nil, Error{Msg: fmt.Sprintf("smpp: sequence number %d already in flight", seq)}
+	}
 	if err := sess.makeTransition(req.CommandID(), false); err != nil {
 		sess.conf.Logger.ErrorF("transitioning before send: %s %+v", sess, err)
 		sess.mu.Unlock()
 		return nil, err
 	}
-	seq, err := sess.enc.Encode(req)
-	if err != nil {
+	if _, err := sess.encode(req, pdu.EncodeSeq(seq)); err != nil {
 		sess.mu.Unlock()
 		return nil, err
 	}
+	written = true
 	l := make(chan response, 1)
 	sess.sent[seq] = l
-	sess.conf.Logger.InfoF("request sent: %s %s%+v", sess, req.CommandID(), req)
+	sess.conf.Metrics.WindowChanged(1, 0)
+	sess.conf.Logger.InfoF("request sent: %s %s", sess, pduDump{req})
 	sess.mu.Unlock()
+	return &Call{
+		sess: sess,
+		seq:  seq,
+		l:    l,
+	}, nil
+}
+
+// Call represents request that is waiting for the response from the peer.
+type Call struct {
+	sess *Session
+	seq  uint32
+	l    chan response
+}
+
+// Seq returns sequence number of the request.
+func (c *Call) Seq() uint32 {
+	return c.seq
+}
+
+// Wait blocks until the response is received or context is done.
+// If context is done first the call is canceled.
+func (c *Call) Wait(ctx context.Context) (pdu.PDU, error) {
 	select {
-	case resp, ok := <-l:
+	case resp, ok := <-c.l:
 		if !ok {
-			return nil, errors.New("smpp: session closed before receiving response")
+			return nil, ErrSessionClosed
 		}
 		if resp.err != nil {
 			return resp.resp, resp.err
 		}
 		return resp.resp, nil
 	case <-ctx.Done():
+		c.Cancel()
 		return nil, ctx.Err()
 	}
 }
 
+// Cancel stops waiting for the response and frees its place in the sending
+// window. Waiting caller is unblocked with context.Canceled error. It has no
+// effect if the response was already received.
+func (c *Call) Cancel() {
+	c.sess.mu.Lock()
+	l, ok := c.sess.sent[c.seq]
+	if !ok || l != c.l {
+		c.sess.mu.Unlock()
+		return
+	}
+	c.sess.deleteSent(c.seq)
+	c.sess.mu.Unlock()
+	l <- response{err: context.Canceled}
+}
+
 // makeTransition checks if processing pdu ID in the current session state is valid operation,
 // if yes it transitions state to the new one triggered by ID.
 //
@@ -510,7 +1498,7 @@ func (sess *Session) makeTransition(ID pdu.CommandID, received bool) error {
 			switch ID {
 			case pdu.UnbindID:
 				return sess.setState(StateUnbinding)
-			case pdu.SubmitSmRespID, pdu.SubmitMultiRespID, pdu.DataSmID, pdu.DataSmRespID, pdu.DeliverSmRespID,
+			case pdu.SubmitSmRespID, pdu.SubmitMultiRespID, pdu.DataSmID, pdu.DataSmRespID, pdu.DeliverSmID, pdu.DeliverSmRespID,
 				pdu.QuerySmRespID, pdu.CancelSmRespID, pdu.AlertNotificationID, pdu.ReplaceSmRespID, pdu.EnquireLinkID, pdu.EnquireLinkRespID,
 				pdu.GenericNackID:
 				return nil
@@ -522,9 +1510,67 @@ func (sess *Session) makeTransition(ID pdu.CommandID, received bool) error {
 		case StateClosing, StateClosed:
 		}
 	}
+	if sess.conf.DisableStateMachine && sess.state != StateClosing && sess.state != StateClosed {
+		sess.conf.Logger.InfoF("ignoring invalid transition: %s %s in state %s", sess, ID, sess.state)
+		return nil
+	}
+	switch sess.state {
+	case StateOpen, StateBinding:
+		return ErrNotBound
+	case StateClosing, StateClosed:
+		return ErrSessionClosed
+	}
 	return Error{Msg: fmt.Sprintf("smpp: processing '%s' in invalid session state '%s'", ID, sess.state), Temp: true}
 }
 
+// permitTransition reports if received PDU with invalid transition can still be
+// processed. Only requests not affecting session state are permitted in
+// bound states when session is configured with PermissiveTransitions.
+//
+// Must be guarded by mutex.
+func (sess *Session) permitTransition(ID pdu.CommandID) bool {
+	if !sess.conf.PermissiveTransitions || !pdu.IsRequest(ID) {
+		return false
+	}
+	switch sess.state {
+	case StateBoundTx, StateBoundRx, StateBoundTRx:
+	default:
+		return false
+	}
+	switch ID {
+	case pdu.BindTransceiverID, pdu.BindTransmitterID, pdu.BindReceiverID, pdu.OutbindID:
+		return false
+	}
+	return true
+}
+
+// Err returns error that caused session to close. It returns nil if session
+// is still active or if it was closed intentionally.
+func (sess *Session) Err() error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.err
+}
+
+// CloseReason returns the reason why session was closed. It should be read
+// after the channel returned by NotifyClosed is closed, before that it
+// returns CloseUnknown.
+func (sess *Session) CloseReason() CloseReason {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.reason
+}
+
+// setCloseReason records the first reason that led to closing the session.
+//
+// Must be guarded by mutex.
+func (sess *Session) setCloseReason(reason CloseReason) {
+	if sess.reason != CloseUnknown {
+		return
+	}
+	sess.reason = reason
+}
+
 // NotifyClosed provides channel that will be closed once session enters closed state.
 func (sess *Session) NotifyClosed() <-chan struct{} {
 	return sess.closed
@@ -546,6 +1592,33 @@ func (se StatusError) Status() pdu.Status {
 	return se.status
 }
 
+// GenericNackError is returned when peer responds to the request with generic_nack.
+type GenericNackError struct {
+	status pdu.Status
+}
+
+// Error implements error interface.
+func (ge GenericNackError) Error() string {
+	return fmt.Sprintf("smpp: generic_nack received with status '0x%X'", int(ge.status))
+}
+
+// Status returns PDU status code of the generic_nack.
+func (ge GenericNackError) Status() pdu.Status {
+	return ge.status
+}
+
+// Unwrap returns StatusError matching generic_nack status.
+func (ge GenericNackError) Unwrap() error {
+	return toError(ge.status)
+}
+
+func responseError(h pdu.Header) error {
+	if h.CommandID() == pdu.GenericNackID {
+		return GenericNackError{h.Status()}
+	}
+	return toError(h.Status())
+}
+
 func toError(status pdu.Status) error {
 	switch status {
 	case pdu.StatusOK:
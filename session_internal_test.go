@@ -0,0 +1,29 @@
+package smpp
+
+import "testing"
+
+func TestSetStateTransitions(t *testing.T) {
+	for _, tc := range []struct {
+		from, to SessionState
+		valid    bool
+	}{
+		{StateOpen, StateBinding, true},
+		{StateOpen, StateClosing, false},
+		{StateBinding, StateBoundTRx, true},
+		{StateBinding, StateClosing, false},
+		{StateBoundTRx, StateUnbinding, true},
+		{StateBoundTRx, StateOpen, false},
+		{StateUnbinding, StateClosing, true},
+		{StateClosing, StateClosed, true},
+		{StateClosed, StateClosing, false},
+	} {
+		sess := &Session{state: tc.from, conf: &SessionConf{Metrics: noopMetrics{}}}
+		err := sess.setState(tc.to)
+		if tc.valid && err != nil {
+			t.Errorf("%s => %s unexpected error %v", tc.from, tc.to, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s => %s expected error", tc.from, tc.to)
+		}
+	}
+}
@@ -3,6 +3,11 @@ package smpp_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -262,3 +267,2362 @@ func TestSMSCSession(t *testing.T) {
 		}
 	}
 }
+
+func TestESMESessionCancelCall(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	bindTRxResp := bindTRx.Response("SMSC")
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	submitSmResp := submitSm.Response("id0")
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRxResp)).
+		ByteWrite(e.i(submitSm)).NoResp().
+		ByteWrite(e.i(submitSm)).ByteRead(e.s(submitSmResp)).
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	call1, err := sess.SendAsync(submitSm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call2, err := sess.SendAsync(submitSm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call1.Cancel()
+	if _, err := call1.Wait(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled got %v", err)
+	}
+	resp, err := call2.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.CommandID() != pdu.SubmitSmRespID {
+		t.Errorf("expected SubmitSmRespID got %d", resp.CommandID())
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	errors := conn.Validate()
+	if errors != nil {
+		for _, err := range errors {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSessionSentinelErrors(t *testing.T) {
+	conn := mock.NewConn().Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	type temporary interface {
+		Temporary() bool
+	}
+	_, err := sess.Send(ctx, submitSm)
+	if !errors.Is(err, smpp.ErrNotBound) {
+		t.Errorf("expected ErrNotBound got %v", err)
+	}
+	if tmp, ok := err.(temporary); !ok || !tmp.Temporary() {
+		t.Errorf("expected temporary error got %v", err)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	_, err = sess.Send(ctx, submitSm)
+	if !errors.Is(err, smpp.ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed got %v", err)
+	}
+	// Closed session never recovers so retrying is pointless.
+	if tmp, ok := err.(temporary); !ok || tmp.Temporary() {
+		t.Errorf("expected permanent error got %v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionBoundTRxReceivesDeliverSm(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	deliverSm := &pdu.DeliverSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "id:0 stat:DELIVRD",
+	}
+	e := newTestEncoder(0)
+	peer := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(peer.i(deliverSm)).ByteWrite(peer.s(deliverSm.Response(""))).Wait(1).
+		Closed()
+	sync := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			defer close(sync)
+			dsm, err := ctx.DeliverSm()
+			if err != nil {
+				t.Errorf("Handler can't get DeliverSm request %v", err)
+				return
+			}
+			if err := ctx.Respond(dsm.Response(""), pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond to DeliverSm request %v", err)
+			}
+		}),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for deliver_sm")
+	case <-sync:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionAutoRespondAfterFailedRespond(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	deliverSm := &pdu.DeliverSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "hello",
+	}
+	e := newTestEncoder(0)
+	peer := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(peer.i(deliverSm)).ByteWrite(peer.s(&pdu.DeliverSmResp{})).Wait(1).
+		Closed()
+	failed := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		AutoRespondDeliver: true,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			defer close(failed)
+			// deliver_sm_resp can't exceed the limit so use oversized pdu
+			// that's allowed by the state but fails to encode.
+			resp := &pdu.SubmitSmResp{
+				Options: pdu.NewOptions().Set(pdu.TagMessagePayload, make([]byte, pdu.MaxPDUSize)),
+			}
+			if err := ctx.Respond(resp, pdu.StatusOK); err == nil {
+				t.Errorf("expected error responding with oversized pdu")
+			}
+		}),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for deliver_sm")
+	case <-failed:
+	}
+	// Give the session time to send automatic response.
+	time.Sleep(10 * time.Millisecond)
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionPermissiveTransitions(t *testing.T) {
+	bindTx := &pdu.BindTx{
+		SystemID: "ESME",
+	}
+	bindTxResp := bindTx.Response("SMSC")
+	deliverSm := &pdu.DeliverSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "id:0 stat:DELIVRD",
+	}
+	deliverSmResp := deliverSm.Response("")
+	e := newTestEncoder(0)
+	peer := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTx)).ByteRead(e.s(bindTxResp)).
+		ByteRead(peer.i(deliverSm)).ByteWrite(peer.s(deliverSmResp)).Wait(1).
+		Closed()
+	sync := make(chan struct{})
+	conf := smpp.SessionConf{
+		PermissiveTransitions: true,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			defer close(sync)
+			dsm, err := ctx.DeliverSm()
+			if err != nil {
+				t.Errorf("Handler can't get DeliverSm request %v", err)
+				return
+			}
+			if err := ctx.Respond(dsm.Response(""), pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond to DeliverSm request %v", err)
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for deliver_sm")
+	case <-sync:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionAutoRespondDeliver(t *testing.T) {
+	bindRx := &pdu.BindRx{
+		SystemID: "ESME",
+	}
+	bindRxResp := bindRx.Response("SMSC")
+	deliverSm := &pdu.DeliverSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	e := newTestEncoder(0)
+	peer := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindRx)).ByteRead(e.s(bindRxResp)).
+		ByteRead(peer.i(deliverSm)).ByteWrite(peer.s(&pdu.DeliverSmResp{})).Wait(1).
+		Closed()
+	received := make(chan struct{})
+	conf := smpp.SessionConf{
+		AutoRespondDeliver: true,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			defer close(received)
+			if _, err := ctx.DeliverSm(); err != nil {
+				t.Errorf("Handler can't get DeliverSm request %v", err)
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindRx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for deliver_sm")
+	case <-received:
+	}
+	// Give session time to send automatic response.
+	time.Sleep(10 * time.Millisecond)
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionDrain(t *testing.T) {
+	client, server := net.Pipe()
+	respond := make(chan struct{})
+	go func() {
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx := p.(*pdu.BindTRx)
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+			return
+		}
+		h, p, err = dec.Decode()
+		if err != nil {
+			t.Errorf("decoding submit_sm %v", err)
+			return
+		}
+		<-respond
+		sm := p.(*pdu.SubmitSm)
+		if _, err := enc.Encode(sm.Response("id0"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding submit_sm resp %v", err)
+		}
+	}()
+	sess := smpp.NewSession(client, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	call, err := sess.SendAsync(submitSm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan error)
+	go func() {
+		drained <- sess.Drain(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := sess.SendAsync(submitSm); !errors.Is(err, smpp.ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed while draining got %v", err)
+	}
+	close(respond)
+	resp, err := call.Wait(ctx)
+	if err != nil {
+		t.Fatalf("in-flight send failed %v", err)
+	}
+	if resp.CommandID() != pdu.SubmitSmRespID {
+		t.Errorf("expected SubmitSmRespID got %s", resp.CommandID())
+	}
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Errorf("unexpected drain error %v", err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for drain")
+	}
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(100 * time.Millisecond):
+		t.Error("session close timeout")
+	}
+}
+
+func TestESMESessionDrainConnectionDropped(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx := p.(*pdu.BindTRx)
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+			return
+		}
+		if _, _, err := dec.Decode(); err != nil {
+			t.Errorf("decoding submit_sm %v", err)
+			return
+		}
+		// Drop the connection without responding.
+		time.Sleep(10 * time.Millisecond)
+		server.Close()
+	}()
+	sess := smpp.NewSession(client, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	if _, err := sess.SendAsync(submitSm); err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan error)
+	go func() {
+		// Context without deadline relies on session close to return.
+		drained <- sess.Drain(context.Background())
+	}()
+	select {
+	case err := <-drained:
+		if !errors.Is(err, smpp.ErrSessionClosed) {
+			t.Errorf("expected ErrSessionClosed got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drain didn't return after connection was dropped")
+	}
+}
+
+type addrConn struct {
+	*mock.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func TestSMSCSessionBindValidator(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"), pdu.StatusBindFail)).
+		Closed()
+	conf := smpp.SessionConf{
+		SystemID: "SMSC",
+		Type:     smpp.SMSC,
+		BindValidator: func(ctx *smpp.Context) (pdu.Status, bool) {
+			if _, err := ctx.BindTRx(); err != nil {
+				t.Errorf("Validator can't get BindTRx request %v", err)
+			}
+			host, _, err := net.SplitHostPort(ctx.RemoteAddr())
+			if err != nil || host != "127.0.0.1" {
+				return pdu.StatusBindFail, false
+			}
+			return pdu.StatusOK, true
+		},
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			t.Errorf("Handler called for rejected bind %s", ctx.CommandID())
+		}),
+	}
+	sess := smpp.NewSession(addrConn{
+		Conn: conn,
+		addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234},
+	}, conf)
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("session close timeout")
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionBindValidatorAlreadyBound(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	peer := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(peer.i(bindTRx)).ByteWrite(peer.s(bindTRx.Response("SMSC"))).
+		ByteRead(peer.i(bindTRx)).ByteWrite(peer.s(bindTRx.Response("SMSC"), pdu.StatusAlyBnd)).
+		Closed()
+	var validated int32
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		SystemID: "SMSC",
+		Type:     smpp.SMSC,
+		BindValidator: func(ctx *smpp.Context) (pdu.Status, bool) {
+			if atomic.AddInt32(&validated, 1) > 1 {
+				return pdu.StatusBindFail, false
+			}
+			return pdu.StatusOK, true
+		},
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if err := ctx.AcceptBind("SMSC"); err != nil {
+				t.Errorf(err.Error())
+			}
+		}),
+	})
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&validated); n != 1 {
+		t.Errorf("validator called %d times expected 1", n)
+	}
+	if st := sess.State(); st != smpp.StateBoundTRx {
+		t.Errorf("State() => %s expected %s", st, smpp.StateBoundTRx)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSessionErr(t *testing.T) {
+	conn := mock.NewConn().
+		ByteRead([]byte{0, 0, 0, 8, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1}).NoResp().
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("session close timeout")
+	}
+	if err := sess.Err(); err == nil || err.Error() != "smpp: pdu length under lower limit" {
+		t.Errorf("expected decode error got %v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionGenericNackResponse(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	bindTRxResp := bindTRx.Response("SMSC")
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRxResp)).
+		ByteWrite(e.i(submitSm)).ByteRead(e.s(&pdu.GenericNack{}, pdu.StatusInvCmdID)).
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := smpp.SendSubmitSm(ctx, sess, submitSm)
+	if resp != nil {
+		t.Errorf("expected nil response got %+v", resp)
+	}
+	var nerr smpp.GenericNackError
+	if !errors.As(err, &nerr) {
+		t.Fatalf("expected GenericNackError got %v", err)
+	}
+	if nerr.Status() != pdu.StatusInvCmdID {
+		t.Errorf("expected status %s got %s", pdu.StatusInvCmdID, nerr.Status())
+	}
+	var serr smpp.StatusError
+	if !errors.As(err, &serr) || serr.Status() != pdu.StatusInvCmdID {
+		t.Errorf("expected wrapped StatusError got %v", err)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionHandlerConcurrency(t *testing.T) {
+	const (
+		requests    = 6
+		concurrency = 2
+	)
+	var running, maxRunning, handled int32
+	done := make(chan struct{})
+	conf := smpp.SessionConf{
+		Type:               smpp.SMSC,
+		SystemID:           "SMSC",
+		HandlerConcurrency: concurrency,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				btrx, err := ctx.BindTRx()
+				if err != nil {
+					t.Errorf("Handler can't get BindTRx request %v", err)
+					return
+				}
+				if err := ctx.Respond(btrx.Response("SMSC"), pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to bind request %v", err)
+				}
+			case pdu.SubmitSmID:
+				n := atomic.AddInt32(&running, 1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				sm, err := ctx.SubmitSm()
+				if err != nil {
+					t.Errorf("Handler can't get SubmitSm request %v", err)
+					return
+				}
+				if err := ctx.Respond(sm.Response("id"), pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to SubmitSm request %v", err)
+				}
+				if atomic.AddInt32(&handled, 1) == requests {
+					close(done)
+				}
+			}
+		}),
+	}
+	client, server := net.Pipe()
+	sess := smpp.NewSession(server, conf)
+	defer sess.Close()
+	enc := pdu.NewEncoder(client, nil)
+	if _, err := enc.Encode(&pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pdu.NewDecoder(client).Decode(); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(ioutil.Discard, client)
+	for i := 0; i < requests; i++ {
+		sm := &pdu.SubmitSm{
+			SourceAddr:      "source",
+			DestinationAddr: "destination",
+			ShortMessage:    "this is the message",
+		}
+		if _, err := enc.Encode(sm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timeout waiting for handlers")
+	}
+	if max := atomic.LoadInt32(&maxRunning); max > concurrency {
+		t.Errorf("expected at most %d concurrent handlers got %d", concurrency, max)
+	}
+}
+
+func TestSMSCSessionAdvertiseVersion(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	bindTRxResp := bindTRx.Response("SMSC")
+	bindTRxResp.Options = pdu.NewOptions().SetScInterfaceVersion(smpp.Version)
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRxResp)).
+		Closed()
+	responded := make(chan struct{})
+	conf := smpp.SessionConf{
+		Type:             smpp.SMSC,
+		AdvertiseVersion: smpp.Version,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			defer close(responded)
+			btrx, err := ctx.BindTRx()
+			if err != nil {
+				t.Errorf("Handler can't get BindTRx request %v", err)
+				return
+			}
+			if err := ctx.Respond(btrx.Response("SMSC"), pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond to bind request %v", err)
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for bind")
+	case <-responded:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionMalformedBody(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	bindTRxResp := bindTRx.Response("SMSC")
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	malformed := []byte{
+		0x00, 0x00, 0x00, 0x13, 0x00, 0x00, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		'a', 'b', 'c',
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRxResp)).
+		ByteRead(malformed).ByteWrite(e.i(&pdu.GenericNack{}, pdu.StatusSysErr)).Wait(1).
+		ByteRead(e.i(submitSm)).ByteWrite(e.s(submitSm.Response("id0"))).Wait(2).
+		Closed()
+	handled := make(chan struct{})
+	conf := smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				btrx, err := ctx.BindTRx()
+				if err != nil {
+					t.Errorf("Handler can't get BindTRx request %v", err)
+					return
+				}
+				if err := ctx.Respond(btrx.Response("SMSC"), pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to bind request %v", err)
+				}
+			case pdu.SubmitSmID:
+				defer close(handled)
+				sm, err := ctx.SubmitSm()
+				if err != nil {
+					t.Errorf("Handler can't get SubmitSm request %v", err)
+					return
+				}
+				if err := ctx.Respond(sm.Response("id0"), pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to SubmitSm request %v", err)
+				}
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for submit_sm after malformed pdu")
+	case <-handled:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionUnknownCommand(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	unknown := []byte{
+		0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x01, 0x99,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(unknown).ByteWrite(e.i(&pdu.GenericNack{}, pdu.StatusInvCmdID)).Wait(1).
+		ByteRead(e.i(submitSm)).ByteWrite(e.s(submitSm.Response("id0"))).Wait(2).
+		Closed()
+	handled := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("Handler can't accept bind %v", err)
+				}
+			case pdu.SubmitSmID:
+				defer close(handled)
+				if err := ctx.Respond(submitSm.Response("id0"), pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to SubmitSm request %v", err)
+				}
+			}
+		}),
+	})
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for submit_sm after unknown command")
+	case <-handled:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionEchoGenericNack(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	malformed := []byte{
+		0x00, 0x00, 0x00, 0x13, 0x00, 0x00, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		'a', 'b', 'c',
+	}
+	nack := &pdu.GenericNack{
+		OriginalCommandID: pdu.SubmitSmID,
+		OriginalSequence:  2,
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(malformed).ByteWrite(e.i(nack, pdu.StatusSysErr)).Wait(1).
+		ByteRead(e.i(submitSm)).ByteWrite(e.s(submitSm.Response("id0"))).Wait(2).
+		Closed()
+	handled := make(chan struct{})
+	conf := smpp.SessionConf{
+		Type:            smpp.SMSC,
+		EchoGenericNack: true,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("Handler can't respond to bind request %v", err)
+				}
+			case pdu.SubmitSmID:
+				defer close(handled)
+				if err := ctx.Respond(submitSm.Response("id0"), pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to SubmitSm request %v", err)
+				}
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for submit_sm after malformed pdu")
+	case <-handled:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionAcceptBind(t *testing.T) {
+	bindRx := &pdu.BindRx{
+		SystemID: "ESME",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindRx)).ByteWrite(e.s(bindRx.Response("SMSC"))).
+		Closed()
+	responded := make(chan struct{})
+	conf := smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			defer close(responded)
+			if err := ctx.AcceptBind("SMSC"); err != nil {
+				t.Errorf("Handler can't accept bind %v", err)
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for bind")
+	case <-responded:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionPing(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRx.Response("SMSC"))).
+		ByteWrite(e.i(&pdu.EnquireLink{})).ByteRead(e.s(&pdu.EnquireLinkResp{})).
+		ByteWrite(e.i(&pdu.EnquireLink{})).NoResp().
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Ping(ctx); err != nil {
+		t.Errorf("expected successful ping got %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sess.Ping(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded got %v", err)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionAllowedSystemTypes(t *testing.T) {
+	bindTx := &pdu.BindTx{
+		SystemID:   "ESME",
+		SystemType: "OTHER",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTx)).ByteWrite(e.s(bindTx.Response("SMSC"), pdu.StatusInvSysTyp)).
+		Closed()
+	conf := smpp.SessionConf{
+		SystemID:           "SMSC",
+		Type:               smpp.SMSC,
+		AllowedSystemTypes: []string{"SMPP", "VMS"},
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			t.Errorf("Handler called for rejected bind %s", ctx.CommandID())
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("session close timeout")
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+type accountKey struct{}
+
+func TestSMSCSessionContextValues(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("acme"))).
+		Closed()
+	responded := make(chan struct{})
+	handler := smpp.HandlerFunc(func(ctx *smpp.Context) {
+		defer close(responded)
+		account, ok := ctx.Get(accountKey{}).(string)
+		if !ok {
+			t.Errorf("expected account value in context")
+			return
+		}
+		if err := ctx.AcceptBind(account); err != nil {
+			t.Errorf("Handler can't accept bind %v", err)
+		}
+	})
+	middleware := smpp.HandlerFunc(func(ctx *smpp.Context) {
+		ctx.Set(accountKey{}, "acme")
+		handler.ServeSMPP(ctx)
+	})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type:    smpp.SMSC,
+		Handler: middleware,
+	})
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for bind")
+	case <-responded:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionEnquireLinkInterval(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	e := newTestEncoder(0)
+	srv := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteWrite(srv.i(&pdu.EnquireLink{})).NoResp().
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type:                smpp.SMSC,
+		EnquireLinkInterval: 20 * time.Millisecond,
+		WindowTimeout:       30 * time.Millisecond,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if err := ctx.AcceptBind("SMSC"); err != nil {
+				t.Errorf("Handler can't accept bind %v", err)
+			}
+		}),
+	})
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("silent peer wasn't closed")
+	}
+	if err := sess.Err(); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded got %v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionRespondOversized(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "111",
+		DestinationAddr: "222",
+		ShortMessage:    "Hello",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(e.i(submitSm)).Wait(1).ByteWrite(e.s(submitSm.Response("id"))).
+		Closed()
+	responded := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.BindTransceiverID {
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("Handler can't accept bind %v", err)
+				}
+				return
+			}
+			defer close(responded)
+			resp := &pdu.SubmitSmResp{
+				MessageID: "id",
+				Options:   pdu.NewOptions().SetMessagePayload(string(make([]byte, pdu.MaxPDUSize))),
+			}
+			if err := ctx.Respond(resp, pdu.StatusOK); err == nil {
+				t.Errorf("expected error responding with oversized pdu")
+			}
+			if err := ctx.Respond(&pdu.SubmitSmResp{MessageID: "id"}, pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond %v", err)
+			}
+		}),
+	})
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for response")
+	case <-responded:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionContextSend(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ESME",
+	}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "111",
+		DestinationAddr: "222",
+		ShortMessage:    "Hello",
+	}
+	e := newTestEncoder(0)
+	srv := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(e.i(submitSm)).Wait(1).ByteWrite(e.s(submitSm.Response("id"))).
+		ByteWrite(srv.i(&pdu.EnquireLink{})).ByteRead(srv.s(&pdu.EnquireLinkResp{})).
+		Closed()
+	responded := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.BindTransceiverID {
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("Handler can't accept bind %v", err)
+				}
+				return
+			}
+			defer close(responded)
+			resp, err := ctx.Send(&pdu.EnquireLink{})
+			if err != nil {
+				t.Errorf("Handler can't send enquire_link %v", err)
+			} else if resp.CommandID() != pdu.EnquireLinkRespID {
+				t.Errorf("expected enquire_link_resp got %s", resp.CommandID())
+			}
+			if err := ctx.Respond(submitSm.Response("id"), pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond %v", err)
+			}
+			if err := ctx.Respond(submitSm.Response("id"), pdu.StatusOK); err == nil {
+				t.Errorf("expected error responding twice")
+			}
+		}),
+	})
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for response")
+	case <-responded:
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSessionConn(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(ioutil.Discard, c)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	if _, ok := sess.Conn().(*net.TCPConn); !ok {
+		t.Errorf("expected *net.TCPConn got %T", sess.Conn())
+	}
+	sess.Close()
+	mconn := mock.NewConn().Closed()
+	sess = smpp.NewSession(mconn, smpp.SessionConf{})
+	if c := sess.Conn(); c != nil {
+		t.Errorf("expected nil connection got %T", c)
+	}
+	sess.Close()
+}
+
+func TestESMESessionSendRateLimit(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		for {
+			h, p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			var resp pdu.PDU
+			switch p := p.(type) {
+			case *pdu.BindTRx:
+				resp = p.Response("SMSC")
+			case *pdu.EnquireLink:
+				resp = &pdu.EnquireLinkResp{}
+			default:
+				t.Errorf("unexpected pdu %s", h.CommandID())
+				return
+			}
+			if _, err := enc.Encode(resp, pdu.EncodeSeq(h.Sequence())); err != nil {
+				return
+			}
+		}
+	}()
+	const rate, over = 100, 10
+	sess := smpp.NewSession(client, smpp.SessionConf{SendRateLimit: rate})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < rate+over; i++ {
+		if err := sess.Ping(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d, min := time.Since(start), over*time.Second/rate; d < min {
+		t.Errorf("%d sends took %s expected at least %s", rate+over, d, min)
+	}
+}
+
+func TestESMESessionSendAsyncRateLimit(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		for {
+			h, p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			if req, ok := p.(*pdu.BindTRx); ok {
+				if _, err := enc.Encode(req.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	sess := smpp.NewSession(client, smpp.SessionConf{SendRateLimit: 2})
+	defer sess.Close()
+	// Requests rejected before being written don't use up tokens.
+	for i := 0; i < 3; i++ {
+		if _, err := sess.SendAsync(&pdu.EnquireLink{}); !errors.Is(err, smpp.ErrNotBound) {
+			t.Fatalf("expected ErrNotBound got %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.SendNoReply(&pdu.EnquireLink{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.SendAsync(&pdu.EnquireLink{}); !errors.Is(err, smpp.ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited got %v", err)
+	}
+	if err := sess.SendNoReply(&pdu.EnquireLink{}); !errors.Is(err, smpp.ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited got %v", err)
+	}
+}
+
+func TestSMSCSessionPeerSystemID(t *testing.T) {
+	bindTRx := &pdu.BindTRx{
+		SystemID: "ACME",
+	}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "111",
+		DestinationAddr: "222",
+		ShortMessage:    "Hello",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(e.i(submitSm)).Wait(1).ByteWrite(e.s(submitSm.Response("id"))).
+		Closed()
+	responded := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type:     smpp.SMSC,
+		SystemID: "SMSC",
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.BindTransceiverID {
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("Handler can't accept bind %v", err)
+				}
+				return
+			}
+			defer close(responded)
+			if err := ctx.Respond(submitSm.Response("id"), pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond %v", err)
+			}
+		}),
+	})
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout waiting for response")
+	case <-responded:
+	}
+	if id := sess.PeerSystemID(); id != "ACME" {
+		t.Errorf("PeerSystemID() => %q expected ACME", id)
+	}
+	if id := sess.SystemID(); id != "SMSC" {
+		t.Errorf("SystemID() => %q expected SMSC", id)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionCanSubmitReceive(t *testing.T) {
+	tt := []struct {
+		name    string
+		bind    pdu.PDU
+		resp    pdu.PDU
+		submit  bool
+		receive bool
+	}{
+		{"tx", &pdu.BindTx{SystemID: "ESME"}, &pdu.BindTxResp{SystemID: "SMSC"}, true, false},
+		{"rx", &pdu.BindRx{SystemID: "ESME"}, &pdu.BindRxResp{SystemID: "SMSC"}, false, true},
+		{"trx", &pdu.BindTRx{SystemID: "ESME"}, &pdu.BindTRxResp{SystemID: "SMSC"}, true, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestEncoder(0)
+			conn := mock.NewConn().
+				ByteWrite(e.i(tc.bind)).ByteRead(e.s(tc.resp)).
+				Closed()
+			sess := smpp.NewSession(conn, smpp.SessionConf{})
+			if sess.CanSubmit() || sess.CanReceive() {
+				t.Errorf("unbound session can submit or receive")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := sess.Send(ctx, tc.bind); err != nil {
+				t.Fatal(err)
+			}
+			if got := sess.CanSubmit(); got != tc.submit {
+				t.Errorf("CanSubmit() => %t expected %t", got, tc.submit)
+			}
+			if got := sess.CanReceive(); got != tc.receive {
+				t.Errorf("CanReceive() => %t expected %t", got, tc.receive)
+			}
+			if err := sess.Close(); err != nil {
+				t.Errorf("Got error during session close %+v", err)
+			}
+			if errs := conn.Validate(); errs != nil {
+				for _, err := range errs {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionCloseReason(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		e := newTestEncoder(0)
+		bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+		conn := mock.NewConn().
+			ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRx.Response("SMSC"))).
+			Closed()
+		sess := smpp.NewSession(conn, smpp.SessionConf{})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := sess.Send(ctx, bindTRx); err != nil {
+			t.Fatal(err)
+		}
+		if r := sess.CloseReason(); r != smpp.CloseUnknown {
+			t.Errorf("CloseReason() => %s expected %s", r, smpp.CloseUnknown)
+		}
+		if err := sess.Close(); err != nil {
+			t.Errorf("Got error during session close %+v", err)
+		}
+		<-sess.NotifyClosed()
+		if r := sess.CloseReason(); r != smpp.CloseLocal {
+			t.Errorf("CloseReason() => %s expected %s", r, smpp.CloseLocal)
+		}
+		if errs := conn.Validate(); errs != nil {
+			for _, err := range errs {
+				t.Error(err)
+			}
+		}
+	})
+	t.Run("peer unbind", func(t *testing.T) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			dec := pdu.NewDecoder(server)
+			enc := pdu.NewEncoder(server, nil)
+			h, p, err := dec.Decode()
+			if err != nil {
+				t.Errorf("decoding bind %v", err)
+				return
+			}
+			btrx := p.(*pdu.BindTRx)
+			if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+				t.Errorf("encoding bind resp %v", err)
+				return
+			}
+			if _, err := enc.Encode(pdu.Unbind{}); err != nil {
+				t.Errorf("encoding unbind %v", err)
+				return
+			}
+			if _, p, err = dec.Decode(); err != nil {
+				t.Errorf("decoding unbind resp %v", err)
+				return
+			}
+			if p.CommandID() != pdu.UnbindRespID {
+				t.Errorf("expected UnbindRespID got %s", p.CommandID())
+			}
+		}()
+		sess := smpp.NewSession(client, smpp.SessionConf{
+			Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+				if ctx.CommandID() == pdu.UnbindID {
+					ctx.Respond(pdu.UnbindResp{}, pdu.StatusOK)
+					ctx.CloseSession()
+				}
+			}),
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-sess.NotifyClosed():
+		case <-ctx.Done():
+			t.Fatal("session was not closed after peer unbind")
+		}
+		if r := sess.CloseReason(); r != smpp.ClosePeerUnbind {
+			t.Errorf("CloseReason() => %s expected %s", r, smpp.ClosePeerUnbind)
+		}
+	})
+}
+
+func TestSMSCSessionRequestStatus(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	bindTRxResp := bindTRx.Response("SMSC")
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	submitSmResp := submitSm.Response("id0")
+	got := make(chan pdu.Status, 1)
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRxResp)).
+		ByteRead(e.i(submitSm, pdu.StatusSysErr)).Wait(1).ByteWrite(e.s(submitSmResp)).
+		Closed()
+	conf := smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("Handler can't respond to bind request %v", err)
+				}
+			case pdu.SubmitSmID:
+				got <- ctx.RequestStatus()
+				if err := ctx.Respond(submitSmResp, pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to SubmitSm request %v", err)
+				}
+			}
+		}),
+	}
+	sess := smpp.NewSession(conn, conf)
+	select {
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("timeout waiting for request")
+	case st := <-got:
+		if st != pdu.StatusSysErr {
+			t.Errorf("RequestStatus() => %s expected %s", st, pdu.StatusSysErr)
+		}
+	}
+	sess.Close()
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionSendSeq(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx := p.(*pdu.BindTRx)
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+			return
+		}
+		var hs []pdu.Header
+		var sms []*pdu.SubmitSm
+		for i := 0; i < 2; i++ {
+			h, p, err := dec.Decode()
+			if err != nil {
+				t.Errorf("decoding submit_sm %v", err)
+				return
+			}
+			hs = append(hs, h)
+			sms = append(sms, p.(*pdu.SubmitSm))
+		}
+		// Respond in reverse order so responses must be routed by sequence.
+		for i := len(hs) - 1; i >= 0; i-- {
+			resp := sms[i].Response("id-" + sms[i].ShortMessage)
+			if _, err := enc.Encode(resp, pdu.EncodeSeq(hs[i].Sequence())); err != nil {
+				t.Errorf("encoding submit_sm resp %v", err)
+				return
+			}
+		}
+		io.Copy(ioutil.Discard, server)
+	}()
+	// Bind takes 199 so the next generated sequence collides with 200.
+	sess := smpp.NewSession(client, smpp.SessionConf{Sequencer: pdu.NewSequencer(199)})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	// Two logical requests from different downstream clients are sent with
+	// rewritten upstream sequences.
+	upstream := map[uint32]string{100: "a", 200: "b"}
+	calls := map[uint32]*smpp.Call{}
+	for _, seq := range []uint32{100, 200} {
+		call, err := sess.SendAsyncSeq(&pdu.SubmitSm{
+			SourceAddr:      "source",
+			DestinationAddr: "destination",
+			ShortMessage:    upstream[seq],
+		}, seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if call.Seq() != seq {
+			t.Errorf("Seq() => %d expected %d", call.Seq(), seq)
+		}
+		calls[seq] = call
+	}
+	if _, err := sess.SendAsyncSeq(&pdu.EnquireLink{}, 100); err == nil {
+		t.Errorf("expected error sending with sequence already in flight")
+	}
+	if _, err := sess.SendAsync(&pdu.EnquireLink{}); err == nil {
+		t.Errorf("expected error sending with generated sequence already in flight")
+	}
+	for seq, call := range calls {
+		resp, err := call.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := resp.(*pdu.SubmitSmResp).MessageID
+		if id != "id-"+upstream[seq] {
+			t.Errorf("response for sequence %d => %s expected %s", seq, id, "id-"+upstream[seq])
+		}
+	}
+}
+
+func TestESMESessionOnUnmatchedResponse(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	unmatched, err := pdu.Marshal(submitSm.Response("id0"), 42, pdu.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(unmatched).NoResp().Wait(1).
+		Closed()
+	type hookCall struct {
+		h pdu.Header
+		p pdu.PDU
+	}
+	called := make(chan hookCall, 1)
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		OnUnmatchedResponse: func(h pdu.Header, p pdu.PDU) {
+			called <- hookCall{h, p}
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-called:
+		if c.h.CommandID() != pdu.SubmitSmRespID || c.h.Sequence() != 42 {
+			t.Errorf("hook called with %s %d expected %s 42", c.h.CommandID(), c.h.Sequence(), pdu.SubmitSmRespID)
+		}
+		if resp, ok := c.p.(*pdu.SubmitSmResp); !ok || resp.MessageID != "id0" {
+			t.Errorf("hook called with unexpected pdu %+v", c.p)
+		}
+	case <-ctx.Done():
+		t.Fatal("OnUnmatchedResponse wasn't invoked")
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionStopSending(t *testing.T) {
+	client, server := net.Pipe()
+	stopped := make(chan struct{})
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx := p.(*pdu.BindTRx)
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+			return
+		}
+		<-stopped
+		dsm := &pdu.DeliverSm{
+			SourceAddr:      "source",
+			DestinationAddr: "destination",
+			ShortMessage:    "receipt",
+		}
+		if _, err := enc.Encode(dsm); err != nil {
+			t.Errorf("encoding deliver_sm %v", err)
+			return
+		}
+		if _, p, err = dec.Decode(); err != nil {
+			t.Errorf("decoding deliver_sm_resp %v", err)
+			return
+		}
+		if p.CommandID() != pdu.DeliverSmRespID {
+			t.Errorf("expected DeliverSmRespID got %s", p.CommandID())
+		}
+		io.Copy(ioutil.Discard, server)
+	}()
+	delivered := make(chan struct{})
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() == pdu.DeliverSmID {
+				defer close(delivered)
+				if err := ctx.Respond(&pdu.DeliverSmResp{}, pdu.StatusOK); err != nil {
+					t.Errorf("Handler can't respond to DeliverSm request %v", err)
+				}
+			}
+		}),
+	})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	sess.StopSending()
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	if _, err := sess.Send(ctx, submitSm); err != smpp.ErrSendingStopped {
+		t.Errorf("expected ErrSendingStopped got %v", err)
+	}
+	if sess.CanSubmit() {
+		t.Errorf("CanSubmit() should be false after StopSending")
+	}
+	close(stopped)
+	select {
+	case <-delivered:
+	case <-ctx.Done():
+		t.Fatal("deliver_sm didn't reach the handler after StopSending")
+	}
+}
+
+func TestESMESessionSequentialHandling(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx := p.(*pdu.BindTRx)
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+			return
+		}
+		go func() {
+			for _, msg := range []string{"first", "second", "third"} {
+				dsm := &pdu.DeliverSm{
+					SourceAddr:      "source",
+					DestinationAddr: "destination",
+					ShortMessage:    msg,
+				}
+				if _, err := enc.Encode(dsm); err != nil {
+					t.Errorf("encoding deliver_sm %v", err)
+					return
+				}
+			}
+		}()
+		io.Copy(ioutil.Discard, server)
+	}()
+	received := make(chan string, 3)
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		SequentialHandling: true,
+		AutoRespondDeliver: true,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			dsm, err := ctx.DeliverSm()
+			if err != nil {
+				t.Errorf("Handler can't get DeliverSm request %v", err)
+				return
+			}
+			// Slow down the first message so concurrent handling would
+			// let the following ones overtake it.
+			if dsm.ShortMessage == "first" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			received <- dsm.ShortMessage
+		}),
+	})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"first", "second", "third"} {
+		select {
+		case msg := <-received:
+			if msg != expected {
+				t.Errorf("handler received %q expected %q", msg, expected)
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for deliver_sm")
+		}
+	}
+}
+
+func TestESMESessionHijack(t *testing.T) {
+	client, server := net.Pipe()
+	responded := make(chan pdu.Header, 1)
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx := p.(*pdu.BindTRx)
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+			return
+		}
+		dsm := &pdu.DeliverSm{
+			SourceAddr:      "source",
+			DestinationAddr: "destination",
+			ShortMessage:    "async",
+		}
+		if _, err := enc.Encode(dsm, pdu.EncodeSeq(7)); err != nil {
+			t.Errorf("encoding deliver_sm %v", err)
+			return
+		}
+		h, _, err = dec.Decode()
+		if err != nil {
+			t.Errorf("decoding deliver_sm_resp %v", err)
+			return
+		}
+		responded <- h
+		io.Copy(ioutil.Discard, server)
+	}()
+	returned := make(chan struct{})
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		AutoRespondDeliver: true,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if ctx.CommandID() != pdu.DeliverSmID {
+				return
+			}
+			respond, _ := ctx.Hijack()
+			go func() {
+				<-returned
+				if err := respond(&pdu.DeliverSmResp{}, pdu.StatusOK); err != nil {
+					t.Errorf("responding after handler returned %v", err)
+				}
+			}()
+		}),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	// Give the handler time to return before responding.
+	time.Sleep(10 * time.Millisecond)
+	close(returned)
+	select {
+	case h := <-responded:
+		if h.CommandID() != pdu.DeliverSmRespID || h.Sequence() != 7 {
+			t.Errorf("received %s %d expected %s 7", h.CommandID(), h.Sequence(), pdu.DeliverSmRespID)
+		}
+	case <-ctx.Done():
+		t.Fatal("hijacked request wasn't responded")
+	}
+	closed := make(chan struct{})
+	go func() {
+		sess.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("session close blocked after hijacked request was responded")
+	}
+}
+
+func TestESMESessionStats(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	submitSm := &pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}
+	e := newTestEncoder(0)
+	bindFrame, bindRespFrame := e.i(bindTRx), e.s(bindTRx.Response("SMSC"))
+	submitFrame, submitRespFrame := e.i(submitSm), e.s(submitSm.Response("id0"))
+	conn := mock.NewConn().
+		ByteWrite(bindFrame).ByteRead(bindRespFrame).
+		ByteWrite(submitFrame).ByteRead(submitRespFrame).
+		Wait(1).
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.Send(ctx, submitSm); err != nil {
+		t.Fatal(err)
+	}
+	stats := sess.Stats()
+	if expected := uint64(len(bindFrame) + len(submitFrame)); stats.BytesWritten != expected {
+		t.Errorf("BytesWritten => %d expected %d", stats.BytesWritten, expected)
+	}
+	if expected := uint64(len(bindRespFrame) + len(submitRespFrame)); stats.BytesRead != expected {
+		t.Errorf("BytesRead => %d expected %d", stats.BytesRead, expected)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionAcceptUnbind(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(bindTRx)).ByteWrite(e.s(bindTRx.Response("SMSC"))).
+		ByteRead(e.i(pdu.Unbind{})).Wait(1).ByteWrite(e.s(pdu.UnbindResp{})).
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type: smpp.SMSC,
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			switch ctx.CommandID() {
+			case pdu.BindTransceiverID:
+				if err := ctx.AcceptBind("SMSC"); err != nil {
+					t.Errorf("accepting bind %v", err)
+				}
+			case pdu.UnbindID:
+				if err := ctx.AcceptUnbind(); err != nil {
+					t.Errorf("accepting unbind %v", err)
+				}
+			}
+		}),
+	})
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed after accepting unbind")
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSMSCSessionBindResponder(t *testing.T) {
+	rejected := &pdu.BindTRx{SystemID: "blocked"}
+	accepted := &pdu.BindTRx{SystemID: "ESME"}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(e.i(rejected)).ByteWrite(e.s(rejected.Response("SMSC"), pdu.StatusInvSysID)).
+		ByteRead(e.i(accepted)).Wait(1).ByteWrite(e.s(accepted.Response("SMSC"))).
+		Closed()
+	bound := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type:     smpp.SMSC,
+		SystemID: "SMSC",
+		BindResponder: func(req pdu.PDU) (pdu.PDU, pdu.Status) {
+			if pdu.SystemID(req) == "blocked" {
+				return nil, pdu.StatusInvSysID
+			}
+			return nil, pdu.StatusOK
+		},
+		SessionState: func(_, _ string, state smpp.SessionState) {
+			if state == smpp.StateBoundTRx {
+				close(bound)
+			}
+		},
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			t.Errorf("handler invoked for %s", ctx.CommandID())
+		}),
+	})
+	select {
+	case <-bound:
+	case <-time.After(time.Second):
+		t.Fatal("session wasn't bound after rejected bind")
+	}
+	sess.Close()
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSessionBindCollision(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerConn, ok := <-accepted
+	if !ok {
+		t.Fatal("accepting connection failed")
+	}
+	left := smpp.NewSession(conn, smpp.SessionConf{SystemID: "left"})
+	defer left.Close()
+	right := smpp.NewSession(peerConn, smpp.SessionConf{SystemID: "right"})
+	defer right.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errs := make(chan error, 2)
+	for _, sess := range []*smpp.Session{left, right} {
+		go func(sess *smpp.Session) {
+			_, err := sess.Send(ctx, &pdu.BindTRx{SystemID: sess.SystemID()})
+			errs <- err
+		}(sess)
+	}
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		serr, ok := err.(smpp.StatusError)
+		if !ok || serr.Status() != pdu.StatusAlyBnd {
+			t.Errorf("expected StatusAlyBnd error got %v", err)
+		}
+	}
+	// Both sessions are open again so binding can be retried.
+	for _, sess := range []*smpp.Session{left, right} {
+		if st := sess.State(); st != smpp.StateOpen {
+			t.Errorf("State() => %s expected %s", st, smpp.StateOpen)
+		}
+	}
+}
+
+func TestSMSCSessionSendNoReply(t *testing.T) {
+	bindRx := &pdu.BindRx{SystemID: "ESME"}
+	alert := &pdu.AlertNotification{
+		SourceAddr: "38160111222",
+		EsmeAddr:   "1234",
+	}
+	peer := newTestEncoder(0)
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteRead(peer.i(bindRx)).ByteWrite(peer.s(bindRx.Response("SMSC"))).
+		ByteWrite(e.i(alert)).NoResp().
+		ByteWrite(e.i(alert)).NoResp().
+		ByteWrite(e.i(pdu.EnquireLink{})).ByteRead(e.s(pdu.EnquireLinkResp{})).
+		Closed()
+	bound := make(chan struct{})
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		Type:        smpp.SMSC,
+		SendWinSize: 1,
+		SessionState: func(_, _ string, state smpp.SessionState) {
+			if state == smpp.StateBoundRx {
+				close(bound)
+			}
+		},
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			if err := ctx.AcceptBind("SMSC"); err != nil {
+				t.Errorf("accepting bind %v", err)
+			}
+		}),
+	})
+	select {
+	case <-bound:
+	case <-time.After(time.Second):
+		t.Fatal("session wasn't bound")
+	}
+	// Sending window holds single request so it would be full if the
+	// alerts were waiting for responses.
+	for i := 0; i < 2; i++ {
+		if err := sess.SendNoReply(alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, pdu.EnquireLink{}); err != nil {
+		t.Errorf("sending after alerts %v", err)
+	}
+	if err := sess.SendNoReply(&pdu.SubmitSm{}); err == nil {
+		t.Errorf("expected transition error for submit_sm sent by SMSC")
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionWriteRaw(t *testing.T) {
+	bindTRx := &pdu.BindTRx{SystemID: "ESME"}
+	// Captured enquire_link with sequence number 0x2A.
+	frame := []byte{0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x15, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2A}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).ByteRead(e.s(bindTRx.Response("SMSC"))).
+		ByteWrite(frame).NoResp().
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{})
+	if err := sess.WriteRaw(frame); err != smpp.ErrNotBound {
+		t.Errorf("expected ErrNotBound before binding got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Send(ctx, bindTRx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.WriteRaw(frame[:15]); err == nil {
+		t.Errorf("expected error for truncated frame")
+	}
+	if err := sess.WriteRaw(append(frame, 0x00)); err == nil {
+		t.Errorf("expected error for command_length mismatch")
+	}
+	if err := sess.WriteRaw(frame); err != nil {
+		t.Errorf("writing raw frame %v", err)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionDisableStateMachine(t *testing.T) {
+	sm := &pdu.SubmitSm{
+		SourceAddr:      "11111111",
+		DestinationAddr: "22222222",
+		ShortMessage:    "Hello",
+	}
+	e := newTestEncoder(0)
+	conn := mock.NewConn().
+		ByteWrite(e.i(sm)).ByteRead(e.s(sm.Response("id"))).
+		Closed()
+	sess := smpp.NewSession(conn, smpp.SessionConf{
+		DisableStateMachine: true,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := sess.Send(ctx, sm)
+	if err != nil {
+		t.Fatalf("sending submit_sm before bind %v", err)
+	}
+	if _, ok := resp.(*pdu.SubmitSmResp); !ok {
+		t.Errorf("expected submit_sm_resp got %T", resp)
+	}
+	if state := sess.State(); state != smpp.StateOpen {
+		t.Errorf("state => %s expected %s", state, smpp.StateOpen)
+	}
+	if err := sess.Close(); err != nil {
+		t.Errorf("Got error during session close %+v", err)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
+
+func TestESMESessionEnquireLinkRetries(t *testing.T) {
+	client, server := net.Pipe()
+	answered := make(chan struct{})
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		probes := 0
+		for {
+			h, p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			var resp pdu.PDU
+			switch req := p.(type) {
+			case *pdu.BindTRx:
+				resp = req.Response("SMSC")
+			case *pdu.EnquireLink:
+				probes++
+				if probes == 1 {
+					// Leave the first probe unanswered.
+					continue
+				}
+				resp = req.Response()
+			default:
+				continue
+			}
+			if _, err := enc.Encode(resp, pdu.EncodeSeq(h.Sequence())); err != nil {
+				t.Errorf("encoding %s %v", resp.CommandID(), err)
+				return
+			}
+			if probes == 2 {
+				close(answered)
+			}
+		}
+	}()
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		EnquireLinkInterval:   20 * time.Millisecond,
+		EnquireLinkRetries:    2,
+		EnquireLinkRetryDelay: 5 * time.Millisecond,
+		WindowTimeout:         30 * time.Millisecond,
+	})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-answered:
+	case <-sess.NotifyClosed():
+		t.Fatalf("session closed after unanswered probe %v", sess.Err())
+	case <-time.After(time.Second):
+		t.Fatal("second probe wasn't sent")
+	}
+	select {
+	case <-sess.NotifyClosed():
+		t.Fatalf("session closed after answered retry %v", sess.Err())
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestESMESessionEnquireLinkRetriesExhausted(t *testing.T) {
+	client, server := net.Pipe()
+	var probes int32
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		for {
+			h, p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			switch req := p.(type) {
+			case *pdu.BindTRx:
+				if _, err := enc.Encode(req.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+					t.Errorf("encoding bind response %v", err)
+					return
+				}
+			case *pdu.EnquireLink:
+				// Probes are never answered.
+				atomic.AddInt32(&probes, 1)
+			}
+		}
+	}()
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		EnquireLinkInterval:   20 * time.Millisecond,
+		EnquireLinkRetries:    2,
+		EnquireLinkRetryDelay: 5 * time.Millisecond,
+		WindowTimeout:         30 * time.Millisecond,
+	})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sess.NotifyClosed():
+	case <-time.After(time.Second):
+		t.Fatal("session wasn't closed after unanswered probes")
+	}
+	if n := atomic.LoadInt32(&probes); n != 2 {
+		t.Errorf("sent %d probes expected 2", n)
+	}
+}
+
+func TestESMESessionEnquireLinkWindowClosed(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		for {
+			h, p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			// Only bind is answered so submit_sm keeps the window closed.
+			if req, ok := p.(*pdu.BindTRx); ok {
+				if _, err := enc.Encode(req.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+					t.Errorf("encoding bind response %v", err)
+					return
+				}
+			}
+		}
+	}()
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		SendWinSize:         1,
+		EnquireLinkInterval: 10 * time.Millisecond,
+		WindowTimeout:       time.Second,
+	})
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := sess.Send(ctx, &pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.SendAsync(&pdu.SubmitSm{
+		SourceAddr:      "source",
+		DestinationAddr: "destination",
+		ShortMessage:    "this is the message",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sess.NotifyClosed():
+		t.Fatalf("session closed while sending window was closed %v", sess.Err())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSMSCSessionReqWinHighWater(t *testing.T) {
+	client, server := net.Pipe()
+	release := make(chan struct{})
+	sess := smpp.NewSession(server, smpp.SessionConf{
+		Type:                    smpp.SMSC,
+		ReqWinSize:              10,
+		ReqWinHighWater:         2,
+		ReqWinHighWaterFraction: 0.5,
+		BindResponder: func(req pdu.PDU) (pdu.PDU, pdu.Status) {
+			return nil, pdu.StatusOK
+		},
+		Handler: smpp.HandlerFunc(func(ctx *smpp.Context) {
+			<-release
+			if err := ctx.Respond(&pdu.SubmitSmResp{MessageID: "id"}, pdu.StatusOK); err != nil {
+				t.Errorf("Handler can't respond %v", err)
+			}
+		}),
+	})
+	defer sess.Close()
+	dec := pdu.NewDecoder(client)
+	enc := pdu.NewEncoder(client, nil)
+	if _, err := enc.Encode(&pdu.BindTRx{SystemID: "ESME"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 6; i++ {
+			sm := &pdu.SubmitSm{
+				SourceAddr:      "111",
+				DestinationAddr: "222",
+				ShortMessage:    "Hello",
+			}
+			if _, err := enc.Encode(sm); err != nil {
+				t.Errorf("encoding submit_sm %v", err)
+				return
+			}
+		}
+	}()
+	// First two requests fill the window up to the high-water mark, every
+	// second one of the remaining four is throttled.
+	for i := 0; i < 2; i++ {
+		h, _, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.CommandID() != pdu.GenericNackID || h.Status() != pdu.StatusThrottled {
+			t.Errorf("expected throttled generic_nack got %s %s", h.CommandID(), h.Status())
+		}
+	}
+	close(release)
+	for i := 0; i < 4; i++ {
+		h, _, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.CommandID() != pdu.SubmitSmRespID || h.Status() != pdu.StatusOK {
+			t.Errorf("expected handled submit_sm got %s %s", h.CommandID(), h.Status())
+		}
+	}
+	go io.Copy(ioutil.Discard, client)
+}
@@ -50,6 +50,8 @@ package smpp
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net"
 	"time"
 
@@ -78,28 +80,43 @@ type BindConf struct {
 	AddrRange  string
 }
 
-func bind(req pdu.PDU, sc SessionConf, bc BindConf) (*Session, error) {
-	conn, err := net.Dial("tcp", bc.Addr)
+func bind(ctx context.Context, req pdu.PDU, sc SessionConf, bc BindConf) (*Session, error) {
+	d := net.Dialer{Timeout: bindTimeout(sc)}
+	conn, err := d.DialContext(ctx, "tcp", bc.Addr)
 	if err != nil {
 		return nil, err
 	}
+	return bindConn(ctx, conn, req, sc)
+}
+
+// bindConn binds session over conn. If binding fails session is closed
+// and nil is returned so callers don't leak half-open sessions.
+func bindConn(ctx context.Context, conn io.ReadWriteCloser, req pdu.PDU, sc SessionConf) (*Session, error) {
 	sess := NewSession(conn, sc)
-	timeout := sc.WindowTimeout
-	if timeout == 0 {
-		timeout = time.Second * 5
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, bindTimeout(sc))
 	defer cancel()
-	_, err = sess.Send(ctx, req)
+	_, err := sess.Send(ctx, req)
 	if err != nil {
-		return sess, err
+		sess.Close()
+		return nil, err
 	}
 	return sess, nil
 }
 
-// BindTx binds transmitter session.
-func BindTx(sc SessionConf, bc BindConf) (*Session, error) {
-	return bind(&pdu.BindTx{
+// bindTimeout limits both dialing and waiting for the bind response.
+func bindTimeout(sc SessionConf) time.Duration {
+	if sc.WindowTimeout == 0 {
+		return time.Second * 5
+	}
+	return sc.WindowTimeout
+}
+
+func unexpectedResponse(resp pdu.PDU) error {
+	return Error{Msg: fmt.Sprintf("smpp: unexpected response %s", resp.CommandID())}
+}
+
+func bindTx(bc BindConf) *pdu.BindTx {
+	return &pdu.BindTx{
 		SystemID:         bc.SystemID,
 		Password:         bc.Password,
 		SystemType:       bc.SystemType,
@@ -107,12 +124,11 @@ func BindTx(sc SessionConf, bc BindConf) (*Session, error) {
 		AddrTon:          bc.AddrTon,
 		AddrNpi:          bc.AddrNpi,
 		AddressRange:     bc.AddrRange,
-	}, sc, bc)
+	}
 }
 
-// BindRx binds receiver session.
-func BindRx(sc SessionConf, bc BindConf) (*Session, error) {
-	return bind(&pdu.BindRx{
+func bindRx(bc BindConf) *pdu.BindRx {
+	return &pdu.BindRx{
 		SystemID:         bc.SystemID,
 		Password:         bc.Password,
 		SystemType:       bc.SystemType,
@@ -120,12 +136,11 @@ func BindRx(sc SessionConf, bc BindConf) (*Session, error) {
 		AddrTon:          bc.AddrTon,
 		AddrNpi:          bc.AddrNpi,
 		AddressRange:     bc.AddrRange,
-	}, sc, bc)
+	}
 }
 
-// BindTRx binds transreceiver session.
-func BindTRx(sc SessionConf, bc BindConf) (*Session, error) {
-	return bind(&pdu.BindTRx{
+func bindTRx(bc BindConf) *pdu.BindTRx {
+	return &pdu.BindTRx{
 		SystemID:         bc.SystemID,
 		Password:         bc.Password,
 		SystemType:       bc.SystemType,
@@ -133,7 +148,72 @@ func BindTRx(sc SessionConf, bc BindConf) (*Session, error) {
 		AddrTon:          bc.AddrTon,
 		AddrNpi:          bc.AddrNpi,
 		AddressRange:     bc.AddrRange,
-	}, sc, bc)
+	}
+}
+
+// BindTx binds transmitter session. Session is closed if binding fails.
+func BindTx(sc SessionConf, bc BindConf) (*Session, error) {
+	return BindTxContext(context.Background(), sc, bc)
+}
+
+// BindTxContext binds transmitter session. Provided context can be used
+// to abort dialing or binding before the response is received. Dialing and
+// binding are each limited by SessionConf.WindowTimeout, 5s if not set.
+func BindTxContext(ctx context.Context, sc SessionConf, bc BindConf) (*Session, error) {
+	return bind(ctx, bindTx(bc), sc, bc)
+}
+
+// BindTxConn binds transmitter session over already established connection.
+// Addr from BindConf is ignored.
+func BindTxConn(conn io.ReadWriteCloser, sc SessionConf, bc BindConf) (*Session, error) {
+	return bindConn(context.Background(), conn, bindTx(bc), sc)
+}
+
+// BindRx binds receiver session. Session is closed if binding fails.
+func BindRx(sc SessionConf, bc BindConf) (*Session, error) {
+	return BindRxContext(context.Background(), sc, bc)
+}
+
+// BindRxContext binds receiver session. Provided context can be used
+// to abort dialing or binding before the response is received. Dialing and
+// binding are each limited by SessionConf.WindowTimeout, 5s if not set.
+func BindRxContext(ctx context.Context, sc SessionConf, bc BindConf) (*Session, error) {
+	return bind(ctx, bindRx(bc), sc, bc)
+}
+
+// BindRxConn binds receiver session over already established connection.
+// Addr from BindConf is ignored.
+func BindRxConn(conn io.ReadWriteCloser, sc SessionConf, bc BindConf) (*Session, error) {
+	return bindConn(context.Background(), conn, bindRx(bc), sc)
+}
+
+// BindTRx binds transreceiver session. Session is closed if binding fails.
+func BindTRx(sc SessionConf, bc BindConf) (*Session, error) {
+	return BindTRxContext(context.Background(), sc, bc)
+}
+
+// BindTRxContext binds transreceiver session. Provided context can be used
+// to abort dialing or binding before the response is received. Dialing and
+// binding are each limited by SessionConf.WindowTimeout, 5s if not set.
+func BindTRxContext(ctx context.Context, sc SessionConf, bc BindConf) (*Session, error) {
+	return bind(ctx, bindTRx(bc), sc, bc)
+}
+
+// BindTRxConn binds transreceiver session over already established connection.
+// Addr from BindConf is ignored.
+func BindTRxConn(conn io.ReadWriteCloser, sc SessionConf, bc BindConf) (*Session, error) {
+	return bindConn(context.Background(), conn, bindTRx(bc), sc)
+}
+
+// AutoBindReceiverOnOutbind returns function for SessionConf.OnOutbind
+// which binds ESME session as receiver using provided credentials once
+// outbind is received from SMSC. Addr from BindConf is ignored.
+func AutoBindReceiverOnOutbind(bc BindConf) func(ctx *Context) {
+	return func(ctx *Context) {
+		if _, err := ctx.Send(bindRx(bc)); err != nil {
+			ctx.sess.conf.Logger.ErrorF("binding receiver on outbind: %s %+v", ctx.sess, err)
+		}
+	}
 }
 
 // Unbind session will initiate session unbinding and close the session.
@@ -153,11 +233,7 @@ func Unbind(ctx context.Context, sess *Session) error {
 
 // SendGenericNack is a helper function for sending GenericNack PDU.
 func SendGenericNack(ctx context.Context, sess *Session, p *pdu.GenericNack) error {
-	_, err := sess.Send(ctx, p)
-	if err != nil {
-		return err
-	}
-	return nil
+	return sess.SendNoReply(p)
 }
 
 // SendBindRx is a helper function for sending BindRx PDU.
@@ -165,11 +241,14 @@ func SendBindRx(ctx context.Context, sess *Session, p *pdu.BindRx) (*pdu.BindRxR
 	var tresp *pdu.BindRxResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.BindRxResp)
+		tresp, _ = resp.(*pdu.BindRxResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -187,11 +266,14 @@ func SendBindTx(ctx context.Context, sess *Session, p *pdu.BindTx) (*pdu.BindTxR
 	var tresp *pdu.BindTxResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.BindTxResp)
+		tresp, _ = resp.(*pdu.BindTxResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -209,11 +291,14 @@ func SendQuerySm(ctx context.Context, sess *Session, p *pdu.QuerySm) (*pdu.Query
 	var tresp *pdu.QuerySmResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.QuerySmResp)
+		tresp, _ = resp.(*pdu.QuerySmResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -231,11 +316,14 @@ func SendSubmitSm(ctx context.Context, sess *Session, p *pdu.SubmitSm) (*pdu.Sub
 	var tresp *pdu.SubmitSmResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.SubmitSmResp)
+		tresp, _ = resp.(*pdu.SubmitSmResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -253,11 +341,14 @@ func SendDeliverSm(ctx context.Context, sess *Session, p *pdu.DeliverSm) (*pdu.D
 	var tresp *pdu.DeliverSmResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.DeliverSmResp)
+		tresp, _ = resp.(*pdu.DeliverSmResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -275,11 +366,14 @@ func SendUnbind(ctx context.Context, sess *Session, p *pdu.Unbind) (*pdu.UnbindR
 	var tresp *pdu.UnbindResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.UnbindResp)
+		tresp, _ = resp.(*pdu.UnbindResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -297,11 +391,14 @@ func SendReplaceSm(ctx context.Context, sess *Session, p *pdu.ReplaceSm) (*pdu.R
 	var tresp *pdu.ReplaceSmResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.ReplaceSmResp)
+		tresp, _ = resp.(*pdu.ReplaceSmResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -319,11 +416,14 @@ func SendCancelSm(ctx context.Context, sess *Session, p *pdu.CancelSm) (*pdu.Can
 	var tresp *pdu.CancelSmResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.CancelSmResp)
+		tresp, _ = resp.(*pdu.CancelSmResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -341,11 +441,14 @@ func SendBindTRx(ctx context.Context, sess *Session, p *pdu.BindTRx) (*pdu.BindT
 	var tresp *pdu.BindTRxResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.BindTRxResp)
+		tresp, _ = resp.(*pdu.BindTRxResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -360,11 +463,7 @@ func SendBindTRxResp(ctx context.Context, sess *Session, p *pdu.BindTRxResp) err
 
 // SendOutbind is a helper function for sending Outbind PDU.
 func SendOutbind(ctx context.Context, sess *Session, p *pdu.Outbind) error {
-	_, err := sess.Send(ctx, p)
-	if err != nil {
-		return err
-	}
-	return nil
+	return sess.SendNoReply(p)
 }
 
 // SendEnquireLink is a helper function for sending EnquireLink PDU.
@@ -372,11 +471,14 @@ func SendEnquireLink(ctx context.Context, sess *Session, p *pdu.EnquireLink) (*p
 	var tresp *pdu.EnquireLinkResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.EnquireLinkResp)
+		tresp, _ = resp.(*pdu.EnquireLinkResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -394,11 +496,14 @@ func SendSubmitMulti(ctx context.Context, sess *Session, p *pdu.SubmitMulti) (*p
 	var tresp *pdu.SubmitMultiResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.SubmitMultiResp)
+		tresp, _ = resp.(*pdu.SubmitMultiResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -413,11 +518,7 @@ func SendSubmitMultiResp(ctx context.Context, sess *Session, p *pdu.SubmitMultiR
 
 // SendAlertNotification is a helper function for sending AlertNotification PDU.
 func SendAlertNotification(ctx context.Context, sess *Session, p *pdu.AlertNotification) error {
-	_, err := sess.Send(ctx, p)
-	if err != nil {
-		return err
-	}
-	return nil
+	return sess.SendNoReply(p)
 }
 
 // SendDataSm is a helper function for sending DataSm PDU.
@@ -425,11 +526,14 @@ func SendDataSm(ctx context.Context, sess *Session, p *pdu.DataSm) (*pdu.DataSmR
 	var tresp *pdu.DataSmResp
 	resp, err := sess.Send(ctx, p)
 	if resp != nil {
-		tresp = resp.(*pdu.DataSmResp)
+		tresp, _ = resp.(*pdu.DataSmResp)
 	}
 	if err != nil {
 		return tresp, err
 	}
+	if tresp == nil {
+		return nil, unexpectedResponse(resp)
+	}
 	return tresp, nil
 }
 
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/ajankovic/smpp"
+	"github.com/ajankovic/smpp/internal/mock"
 	"github.com/ajankovic/smpp/pdu"
 )
 
@@ -128,3 +130,194 @@ func TestBindToDeadEnd(t *testing.T) {
 		t.Errorf("expected session to be nil got %s", sess)
 	}
 }
+
+func TestBindContextCancel(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// Never respond to the bind request.
+		io.Copy(ioutil.Discard, c)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	conf := smpp.BindConf{
+		Addr: l.Addr().String(),
+	}
+	start := time.Now()
+	sess, err := smpp.BindTRxContext(ctx, smpp.SessionConf{WindowTimeout: 5 * time.Second}, conf)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("bind was not aborted promptly, took %s", d)
+	}
+	if sess != nil {
+		sess.Close()
+	}
+}
+
+func TestBindTRxConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		btrx, ok := p.(*pdu.BindTRx)
+		if !ok {
+			t.Errorf("expected bind_transceiver got %s", p.CommandID())
+			return
+		}
+		if btrx.SystemID != "ESME" {
+			t.Errorf("expected system id ESME got %s", btrx.SystemID)
+		}
+		if _, err := enc.Encode(btrx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+		}
+		io.Copy(ioutil.Discard, server)
+	}()
+	conf := smpp.BindConf{
+		SystemID: "ESME",
+	}
+	sess, err := smpp.BindTRxConn(client, smpp.SessionConf{WindowTimeout: time.Second}, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if !sess.CanSubmit() || !sess.CanReceive() {
+		t.Errorf("expected session to be bound as transceiver got %s", sess.State())
+	}
+}
+
+func TestAutoBindReceiverOnOutbind(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		dec := pdu.NewDecoder(server)
+		enc := pdu.NewEncoder(server, nil)
+		if _, err := enc.Encode(&pdu.Outbind{SystemID: "SMSC", Password: "secret"}); err != nil {
+			t.Errorf("encoding outbind %v", err)
+			return
+		}
+		h, p, err := dec.Decode()
+		if err != nil {
+			t.Errorf("decoding bind %v", err)
+			return
+		}
+		brx, ok := p.(*pdu.BindRx)
+		if !ok {
+			t.Errorf("expected bind_receiver got %s", p.CommandID())
+			return
+		}
+		if brx.SystemID != "ESME" || brx.Password != "secret" {
+			t.Errorf("unexpected bind credentials %s %s", brx.SystemID, brx.Password)
+		}
+		if _, err := enc.Encode(brx.Response("SMSC"), pdu.EncodeSeq(h.Sequence())); err != nil {
+			t.Errorf("encoding bind resp %v", err)
+		}
+		io.Copy(ioutil.Discard, server)
+	}()
+	bound := make(chan struct{})
+	sess := smpp.NewSession(client, smpp.SessionConf{
+		WindowTimeout: time.Second,
+		OnOutbind: smpp.AutoBindReceiverOnOutbind(smpp.BindConf{
+			SystemID: "ESME",
+			Password: "secret",
+		}),
+		SessionState: func(_, _ string, state smpp.SessionState) {
+			if state == smpp.StateBoundRx {
+				close(bound)
+			}
+		},
+	})
+	defer sess.Close()
+	select {
+	case <-bound:
+	case <-time.After(time.Second):
+		t.Fatal("session wasn't bound as receiver after outbind")
+	}
+	if !sess.CanReceive() || sess.CanSubmit() {
+		t.Errorf("expected receiver session got %s", sess.State())
+	}
+}
+
+func TestBindDialTimeout(t *testing.T) {
+	// Peer accepts connections but never responds to bind.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(ioutil.Discard, c)
+				c.Close()
+			}()
+		}
+	}()
+	conf := smpp.BindConf{
+		Addr: l.Addr().String(),
+	}
+	start := time.Now()
+	sess, err := smpp.BindTRx(smpp.SessionConf{WindowTimeout: 50 * time.Millisecond}, conf)
+	if err == nil {
+		t.Errorf("expected error but got nil")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("bind was not aborted promptly, took %s", d)
+	}
+	if sess != nil {
+		t.Errorf("expected nil session after failed bind")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	sess, err = smpp.BindTRxContext(ctx, smpp.SessionConf{}, conf)
+	if err == nil {
+		t.Errorf("expected error but got nil")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("bind was not aborted with context, took %s", d)
+	}
+	if sess != nil {
+		t.Errorf("expected nil session after failed bind")
+	}
+}
+
+func TestBindWithheldResponse(t *testing.T) {
+	e := newTestEncoder(0)
+	bindTRx := &pdu.BindTRx{SystemID: "ESME", InterfaceVersion: smpp.Version}
+	// Peer accepts bind request but never responds.
+	conn := mock.NewConn().
+		ByteWrite(e.i(bindTRx)).NoResp().
+		Closed()
+	sess, err := smpp.BindTRxConn(conn, smpp.SessionConf{WindowTimeout: 20 * time.Millisecond}, smpp.BindConf{SystemID: "ESME"})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded got %v", err)
+	}
+	if sess != nil {
+		t.Errorf("expected session to be nil got %s", sess)
+	}
+	if errs := conn.Validate(); errs != nil {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	}
+}
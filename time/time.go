@@ -22,9 +22,16 @@ const (
 	Relative
 )
 
+// Now returns current time used for relative time calculations.
+// It can be replaced in tests to get deterministic results.
+var Now = gotime.Now
+
 // Parse converts bytestring representation of time from SMPP format
 // to standard time.Time. Relative layouts will be added to the current
-// time and returned as time.Time.
+// time and returned as time.Time. Years, months and days of the relative
+// time are added as calendar values so values out of their usual range are
+// normalized, e.g. 15 months is the same as 1 year and 3 months. Hours,
+// minutes and seconds are added as duration.
 func Parse(in []byte) (gotime.Time, error) {
 	l := len(in)
 	switch l {
@@ -42,19 +49,25 @@ func Parse(in []byte) (gotime.Time, error) {
 		switch layoutIndicator {
 		case 'R':
 			// Relative layout.
+			if !digits(in[:15]) {
+				return gotime.Time{}, fmt.Errorf("smpp/time: invalid relative time %s", in)
+			}
 			y := int((in[0]-48)*10 + (in[1] - 48))
 			mo := int((in[2]-48)*10 + (in[3] - 48))
 			d := int((in[4]-48)*10 + (in[5] - 48))
 			h := int((in[6]-48)*10 + (in[7] - 48))
 			mi := int((in[8]-48)*10 + (in[9] - 48))
 			s := int((in[10]-48)*10 + (in[11] - 48))
-			return gotime.Now().
+			return Now().
 				AddDate(y, mo, d).
 				Add(time.Duration(h)*time.Hour +
 					time.Duration(mi)*time.Minute +
 					time.Duration(s)*time.Second), nil
 		case '-', '+':
 			// Absolute layout.
+			if !digits(in[:15]) {
+				return gotime.Time{}, fmt.Errorf("smpp/time: invalid absolute time %s", in)
+			}
 			nn := int((in[13]-48)*10 + (in[14] - 48))
 			offset := nn * 900 // 15 min intervals in seconds.
 			if layoutIndicator == '-' {
@@ -70,8 +83,9 @@ func Parse(in []byte) (gotime.Time, error) {
 			if err != nil {
 				return time.Time{}, err
 			}
-			t = t.Add(time.Duration(in[12]-48) * 100 * time.Millisecond)
-			return t, nil
+			// Digits were validated so tenths of second are in 0-9 range.
+			tenths := time.Duration(in[12] - '0')
+			return t.Add(tenths * 100 * time.Millisecond), nil
 		default:
 			return gotime.Time{}, fmt.Errorf("smpp/time: invalid layout length %s", in)
 		}
@@ -80,8 +94,18 @@ func Parse(in []byte) (gotime.Time, error) {
 	}
 }
 
+func digits(in []byte) bool {
+	for _, c := range in {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // Format converts time.Time into string representation defined by smpp
-// predefined layout.
+// predefined layout. Absolute layout keeps tenths of second, smaller
+// fractions are truncated.
 func Format(layout Layout, t gotime.Time) (string, error) {
 	switch layout {
 	case SimpleSeconds:
@@ -89,7 +113,7 @@ func Format(layout Layout, t gotime.Time) (string, error) {
 	case SimpleMinutes:
 		return t.Format("0601021504"), nil
 	case Relative:
-		y, mo, d, h, mi, s := diff(t, gotime.Now())
+		y, mo, d, h, mi, s := diff(Now(), t)
 		return fmt.Sprintf("%02d%02d%02d%02d%02d%02d000R", y, mo, d, h, mi, s), nil
 	case Absolute:
 		sign := "+"
@@ -99,57 +123,42 @@ func Format(layout Layout, t gotime.Time) (string, error) {
 			sign = "-"
 			offset = -offset
 		}
-		return fmt.Sprintf("%s%d%02d%s", t.Format("060102150405"), t.Nanosecond()/100000000, offset, sign), nil
+		tenths := t.Nanosecond() / int(100*time.Millisecond)
+		return fmt.Sprintf("%s%d%02d%s", t.Format("060102150405"), tenths, offset, sign), nil
 	default:
 		return "", errors.New("smpp/time: invalid format layout")
 	}
 }
 
-// Go supports only dif with hours so borrowing this from
-// https://stackoverflow.com/questions/36530251/golang-time-since-with-months-and-years
-func diff(a, b time.Time) (year, month, day, hour, min, sec int) {
-	if a.Location() != b.Location() {
-		b = b.In(a.Location())
+// diff returns calendar difference between from and to the same way Parse
+// adds it with AddDate, so relative time formatted from the difference is
+// parsed back into the same instant. Years, months and days are counted in
+// the location of from since that's where Parse adds them.
+func diff(from, to time.Time) (year, month, day, hour, min, sec int) {
+	// Relative time has no fractions of second.
+	from = from.Truncate(time.Second)
+	to = to.In(from.Location()).Truncate(time.Second)
+	if to.Before(from) {
+		from, to = to, from
 	}
-	if a.After(b) {
-		a, b = b, a
+	y1, m1, _ := from.Date()
+	y2, m2, _ := to.Date()
+	// Calendar months are the upper bound, AddDate normalizes overflowing
+	// days into the following month so fewer months may fit.
+	months := (y2-y1)*12 + int(m2-m1)
+	for months > 0 && from.AddDate(0, months, 0).After(to) {
+		months--
 	}
-	y1, M1, d1 := a.Date()
-	y2, M2, d2 := b.Date()
-
-	h1, m1, s1 := a.Clock()
-	h2, m2, s2 := b.Clock()
-
-	year = int(y2 - y1)
-	month = int(M2 - M1)
-	day = int(d2 - d1)
-	hour = int(h2 - h1)
-	min = int(m2 - m1)
-	sec = int(s2 - s1)
-
-	// Normalize negative values
-	if sec < 0 {
-		sec += 60
-		min--
-	}
-	if min < 0 {
-		min += 60
-		hour--
+	days := int(to.Sub(from.AddDate(0, months, 0)) / (24 * time.Hour))
+	for days > 0 && from.AddDate(0, months, days).After(to) {
+		days--
 	}
-	if hour < 0 {
-		hour += 24
-		day--
+	for !from.AddDate(0, months, days+1).After(to) {
+		days++
 	}
-	if day < 0 {
-		// Days in month:
-		t := time.Date(y1, M1, 32, 0, 0, 0, 0, time.UTC)
-		day += 32 - t.Day()
-		month--
-	}
-	if month < 0 {
-		month += 12
-		year--
-	}
-
-	return
+	rest := to.Sub(from.AddDate(0, months, days))
+	hour = int(rest / time.Hour)
+	min = int(rest % time.Hour / time.Minute)
+	sec = int(rest % time.Minute / time.Second)
+	return months / 12, months % 12, days, hour, min, sec
 }
@@ -120,3 +120,120 @@ func TestFormatRelative(t *testing.T) {
 		t.Errorf("format not expected %s", out)
 	}
 }
+
+func TestParseNonDigits(t *testing.T) {
+	for _, in := range []string{
+		"02061023342a000R",
+		"0206102334291x0-",
+		"-20610233429000R",
+	} {
+		if _, err := time.Parse([]byte(in)); err == nil {
+			t.Errorf("expected error for %s got nil", in)
+		}
+	}
+}
+
+func TestRelativeRoundTrip(t *testing.T) {
+	defer func(now func() gotime.Time) { time.Now = now }(time.Now)
+	for _, now := range []gotime.Time{
+		gotime.Date(2020, gotime.June, 10, 12, 30, 0, 0, gotime.UTC),
+		// Month ends are normalized by AddDate into the following month.
+		gotime.Date(2027, gotime.January, 31, 0, 0, 0, 0, gotime.UTC),
+		gotime.Date(2024, gotime.February, 29, 23, 59, 59, 0, gotime.UTC),
+	} {
+		time.Now = func() gotime.Time { return now }
+		for _, d := range []struct {
+			y, mo, d int
+			dur      gotime.Duration
+		}{
+			{0, 0, 0, 10 * gotime.Hour},
+			{0, 0, 3, 4*gotime.Hour + 5*gotime.Minute + 6*gotime.Second},
+			{0, 1, 0, 0},
+			{0, 15, 0, 0},
+			{1, 2, 3, 4*gotime.Hour + 5*gotime.Minute},
+		} {
+			expected := now.AddDate(d.y, d.mo, d.d).Add(d.dur)
+			out, err := time.Format(time.Relative, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := time.Parse([]byte(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !parsed.Equal(expected) {
+				t.Errorf("now %s relative %s parsed as %s expected %s", now, out, parsed, expected)
+			}
+		}
+	}
+}
+
+func TestRelativeMonthEnd(t *testing.T) {
+	defer func(now func() gotime.Time) { time.Now = now }(time.Now)
+	now := gotime.Date(2027, gotime.January, 31, 0, 0, 0, 0, gotime.UTC)
+	time.Now = func() gotime.Time { return now }
+	out, err := time.Format(time.Relative, now.AddDate(0, 15, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "010300000000000R"; out != expected {
+		t.Errorf("Format() => %s expected %s", out, expected)
+	}
+	parsed, err := time.Parse([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := gotime.Date(2028, gotime.May, 1, 0, 0, 0, 0, gotime.UTC); !parsed.Equal(expected) {
+		t.Errorf("Parse() => %s expected %s", parsed, expected)
+	}
+}
+
+func TestRelativeFixedClock(t *testing.T) {
+	fixed := gotime.Date(2020, gotime.January, 31, 20, 0, 0, 0, gotime.UTC)
+	defer func(now func() gotime.Time) { time.Now = now }(time.Now)
+	time.Now = func() gotime.Time { return fixed }
+	out, err := time.Format(time.Relative, fixed.Add(10*gotime.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "000000100000000R"; out != expected {
+		t.Errorf("Format() => %s expected %s", out, expected)
+	}
+	parsed, err := time.Parse([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fixed.Add(10 * gotime.Hour); !parsed.Equal(expected) {
+		t.Errorf("Parse() => %s expected %s", parsed, expected)
+	}
+}
+
+func TestAbsoluteTenthsRoundTrip(t *testing.T) {
+	loc := gotime.FixedZone("Custom", 2*3600)
+	in := gotime.Date(2021, gotime.March, 4, 5, 6, 7, 700000000, loc)
+	out, err := time.Format(time.Absolute, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "210304050607708+"; out != expected {
+		t.Errorf("Format() => %s expected %s", out, expected)
+	}
+	parsed, err := time.Parse([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(in) {
+		t.Errorf("Parse() => %s expected %s", parsed, in)
+	}
+	// Smaller fractions are truncated to tenths.
+	out, err = time.Format(time.Absolute, in.Add(99*gotime.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[12] != '7' {
+		t.Errorf("Format() => %s expected tenths 7", out)
+	}
+	if _, err := time.Parse([]byte("210304050607:08+")); err == nil {
+		t.Errorf("expected error for invalid tenths digit")
+	}
+}